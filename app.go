@@ -2,29 +2,56 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"sync"
-	"sync/atomic"
+	"time"
+	"unicode/utf8"
 
 	"github.com/gen2brain/beeep"
 	wailsRuntime "github.com/wailsapp/wails/v2/pkg/runtime"
 
+	"PureNCM/internal/chinese"
 	"PureNCM/internal/config"
+	"PureNCM/internal/musicbrainz"
 	"PureNCM/internal/ncm"
+	"PureNCM/internal/netease"
 )
 
 // App is the main application struct bound to the Wails frontend.
 type App struct {
 	ctx context.Context
+
+	// The conversion queue, see queue.go
+	mu      sync.Mutex
+	jobs    []*Job            // in dispatch order
+	batches map[string]*batch // by ID, while the queue holds jobs of them
+	wake    *sync.Cond        // signalled when a job may be dispatched
+	gate    ncm.PauseGate     // closed by PauseConversion
+	workers sync.WaitGroup
+	started bool // the workers are running
+	closing bool // the app is shutting down
+	// Shared by all batches, which may run at the same time: reservations
+	// keeps their workers from writing the same output path, mbLimiter
+	// keeps their MusicBrainz lookups to the server's rate
+	reservations *ncm.Reservations
+	mbLimiter    musicbrainz.Limiter
+
+	// Saving and resuming the queue, see session.go
+	queuePath   string
+	interrupted *savedQueue // left unfinished by the last session; nil once resumed or discarded
+	cleanedUp   int         // partial outputs removed at startup
 }
 
 // NewApp creates a new App application struct.
 func NewApp() *App {
-	return &App{}
+	a := &App{batches: map[string]*batch{}, reservations: ncm.NewReservations()}
+	a.wake = sync.NewCond(&a.mu)
+	return a
 }
 
 // startup is called when the app starts.
@@ -33,14 +60,61 @@ func (a *App) startup(ctx context.Context) {
 	if _, err := config.Load(); err != nil {
 		_ = err // non-fatal, continue with defaults
 	}
+	a.loadQueue()
+	var dirs []string
+	if a.interrupted != nil {
+		dirs = a.interrupted.outputDirs()
+	}
+	a.cleanedUp = sweepTempFiles(dirs...)
 }
 
 // --- Config API ---
 
-func (a *App) GetConfig() *config.Config         { return config.Get() }
-func (a *App) SetOutputDir(dir string) error     { return config.SetOutputDir(dir) }
-func (a *App) SetFilenamePattern(p string) error { return config.SetFilenamePattern(p) }
-func (a *App) SetCopyLrc(enabled bool) error     { return config.SetCopyLrc(enabled) }
+func (a *App) GetConfig() *config.Config                       { return config.Get() }
+func (a *App) SetOutputDir(dir string) error                   { return config.SetOutputDir(dir) }
+func (a *App) SetCopyLrc(enabled bool) error                   { return config.SetCopyLrc(enabled) }
+func (a *App) SetOffline(enabled bool) error                   { return config.SetOffline(enabled) }
+func (a *App) SetLrcMode(mode string) error                    { return config.SetLrcMode(mode) }
+func (a *App) SetLrcSearchDirs(dirs []string) error            { return config.SetLrcSearchDirs(dirs) }
+func (a *App) SetLyricsCacheDir(dir string) error              { return config.SetLyricsCacheDir(dir) }
+func (a *App) SetCollisionPolicy(policy string) error          { return config.SetCollisionPolicy(policy) }
+func (a *App) SetChineseConversion(conv string) error          { return config.SetChineseConversion(conv) }
+func (a *App) SetCoverConfig(c config.CoverConfig) error       { return config.SetCover(c) }
+func (a *App) SetFilenameConfig(c config.FilenameConfig) error { return config.SetFilename(c) }
+
+// SetFilenamePattern validates the filename template before saving it, so the
+// settings page can show where a pattern is wrong.
+func (a *App) SetFilenamePattern(p string) error {
+	if _, err := ncm.ParseTemplate(p); err != nil {
+		return err
+	}
+	return config.SetFilenamePattern(p)
+}
+
+// SetFallbackPatterns validates the file name fallback patterns before saving them.
+func (a *App) SetFallbackPatterns(patterns []string) error {
+	for _, p := range patterns {
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		if _, err := ncm.ParseFallbackPattern(p); err != nil {
+			return err
+		}
+	}
+	return config.SetFallbackPatterns(patterns)
+}
+
+// SetRewriteRules validates the metadata rewrite rules before saving them.
+func (a *App) SetRewriteRules(rules []config.RewriteRule) error {
+	if _, err := ncm.NewRewriter(rewriteRules(rules)); err != nil {
+		return err
+	}
+	return config.SetRewriteRules(rules)
+}
+
+func (a *App) SetLyricsLayout(layout string, romaji bool) error {
+	return config.SetLyricsLayout(layout, romaji)
+}
 
 // --- Dialog API ---
 
@@ -62,63 +136,192 @@ func (a *App) OpenDirectoryDialog() (string, error) {
 
 // ConvertProgress is the event payload emitted for each file during conversion.
 type ConvertProgress struct {
+	JobID      string  `json:"jobId"`
+	BatchID    string  `json:"batchId"`
 	Path       string  `json:"path"`
-	Status     string  `json:"status"`   // "converting" | "done" | "error"
+	Status     string  `json:"status"`   // "converting" | "done" | "skipped" | "error" | "cancelled"
 	Size       int64   `json:"size"`     // source file size in bytes
-	Progress   float64 `json:"progress"` // 0.0 – 1.0 write progress
+	Progress   float64 `json:"progress"` // 0.0 – 1.0 across all stages
 	OutputPath string  `json:"outputPath"`
 	Error      string  `json:"error"`
+	// Stage is the current step while converting (see ncm.Stage), with its
+	// own progress, the bytes it has processed and its throughput.
+	Stage         string  `json:"stage,omitempty"`
+	StageProgress float64 `json:"stageProgress,omitempty"`
+	Bytes         int64   `json:"bytes,omitempty"`
+	BytesPerSec   float64 `json:"bytesPerSec,omitempty"`
+	// Lyrics is set on the final "done" event when lyrics handling is enabled.
+	Lyrics *LyricsResult `json:"lyrics,omitempty"`
+	// Enriched is set when details were filled in from the NetEase API;
+	// EnrichError explains a failed lookup.
+	Enriched    bool   `json:"enriched,omitempty"`
+	EnrichError string `json:"enrichError,omitempty"`
+	// MusicBrainz is set on the "done" event when the lookup is enabled.
+	MusicBrainz *MusicBrainzResult `json:"musicbrainz,omitempty"`
+	// Inferred lists the fields ("title", "artist", "album", "track") taken
+	// from the source file name because the NCM metadata lacked them.
+	Inferred []string `json:"inferred,omitempty"`
 }
 
 const EventConvertProgress = "ncm:progress"
 
-// maxWorkers limits concurrent goroutines to the number of logical CPUs.
+// maxWorkers is the number of queue workers, one per logical CPU.
 var maxWorkers = runtime.NumCPU()
 
-// ConvertFiles converts a list of NCM files concurrently.
-// Each file is processed in its own goroutine (pool size = NumCPU).
+// ConvertFiles queues a list of NCM files for conversion; see Enqueue.
 // Progress is streamed via "ncm:progress" Wails events.
 // A system notification is shown when all files are done.
 func (a *App) ConvertFiles(paths []string, outputDir string, pattern string) {
-	total := len(paths)
-	if total == 0 {
-		return
+	_, _ = a.Enqueue(paths, outputDir, pattern)
+}
+
+// batch holds the state shared by all files of one Enqueue call.
+type batch struct {
+	id        string
+	active    bool // has unfinished jobs; cleared once the notification is sent
+	created   time.Time
+	outputDir string // "" = next to each source file
+	pattern   string
+	total     int // number of files, for {index} padding
+	sanitize  ncm.SanitizeOptions
+	script    chinese.Conversion // Simplified/Traditional conversion of the metadata
+	rewriter  *ncm.Rewriter      // user cleanup rules; nil = none
+	fallback  []*ncm.FallbackPattern
+	covers    *ncm.CoverFetcher // shared so each album cover is fetched once
+	cover     ncm.CoverOptions
+	sidecar   ncm.CoverSidecarOptions
+	lyrics    *lyricOptions   // nil = lyrics handling off
+	netease   *netease.Client // metadata enrichment; nil = off
+	// musicbrainz adds MBIDs to confident matches; nil = off
+	musicbrainz *musicbrainz.Client
+	canonical   bool // use MusicBrainz spellings for matched tracks
+	// reservations is the App's table, where the jobs of the batch reserve
+	// their output paths by job ID; collision is read once so every
+	// reservation uses the same keys
+	reservations *ncm.Reservations
+	collision    ncm.CollisionPolicy
+	// planned[i] is closed once the output of file i+1 is planned; nil for
+	// restored batches, whose reservations are loaded with the queue
+	planned []chan struct{}
+}
+
+// newBatch returns a batch for total files, taking its settings from the
+// config. Settings changed later apply to the next batch.
+func (a *App) newBatch(outputDir, pattern string, total int) *batch {
+	cfg := config.Get()
+	// Rules are validated when saved; a bad hand-edited config disables them
+	rewriter, _ := ncm.NewRewriter(rewriteRules(cfg.RewriteRules))
+	return &batch{
+		outputDir:    outputDir,
+		pattern:      pattern,
+		created:      time.Now(),
+		total:        total,
+		sanitize:     sanitizeOptions(cfg.Filename),
+		script:       chinese.Conversion(cfg.ChineseConversion),
+		rewriter:     rewriter,
+		fallback:     fallbackPatterns(cfg.FallbackPatterns),
+		covers:       coverFetcher(cfg),
+		cover:        coverOptions(cfg.Cover),
+		sidecar:      coverSidecarOptions(cfg.Cover),
+		lyrics:       lyricSettings(cfg),
+		netease:      neteaseClient(cfg),
+		musicbrainz:  musicBrainzClient(cfg, &a.mbLimiter),
+		canonical:    cfg.MusicBrainz.Canonical,
+		reservations: a.reservations,
+		collision:    ncm.CollisionPolicy(cfg.CollisionPolicy),
+	}
+}
+
+// outDirFor returns the output directory for source file p.
+func (b *batch) outDirFor(p string) string {
+	if b.outputDir == "" {
+		return filepath.Dir(p)
 	}
+	return b.outputDir
+}
 
-	var (
-		wg     sync.WaitGroup
-		sem    = make(chan struct{}, maxWorkers) // semaphore
-		doneN  atomic.Int32                      // count successfully converted
-		errorN atomic.Int32
-	)
+// planOutputs reserves output paths in input order, so tracks with the same
+// name resolve to the same " (n)" suffixes regardless of which worker runs
+// first. Files that cannot be probed are left to convertOne to report.
+// The plan uses the metadata as stored; when enrichment or MusicBrainz later
+// changes the name, the writer reserves the new path instead.
+//
+// Enqueue runs it in the background, since probing a large batch takes a
+// while; workers wait for a file's plan only before writing it.
+func (b *batch) planOutputs(paths []string) {
+	for i, p := range paths {
+		if planned, err := b.plannedOutput(p, i+1); err == nil {
+			b.reservations.Reserve(planned, jobID(b.id, i+1), b.collision)
+		}
+		if b.planned != nil {
+			close(b.planned[i])
+		}
+	}
+}
 
-	for _, p := range paths {
-		p := p // capture loop variable
-		wg.Add(1)
-		sem <- struct{}{} // acquire slot
+// waitPlanned waits until the output of the index-th file (1-based), and so
+// of every file before it, has been planned. It returns ctx's error if ctx
+// is cancelled first.
+func (b *batch) waitPlanned(ctx context.Context, index int) error {
+	if b.planned == nil {
+		return nil
+	}
+	select {
+	case <-b.planned[index-1]:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
 
-		go func() {
-			defer wg.Done()
-			defer func() { <-sem }() // release slot
+// plannedOutput returns the output path the template gives the index-th
+// file (1-based), before collisions are resolved.
+func (b *batch) plannedOutput(p string, index int) (string, error) {
+	probe, err := ncm.ProbeFile(p)
+	if err != nil {
+		return "", err
+	}
+	b.fillMissing(p, probe.Meta, probe.MetaErr)
+	b.prepareMeta(probe.Meta)
+	return ncm.OutputPath(b.templateData(p, index, probe.Meta, probe.Format), b.outDirFor(p), b.pattern), nil
+}
 
-			a.convertOne(p, outputDir, pattern, &doneN, &errorN)
-		}()
+// fillMissing infers the fields the NCM metadata lacks from the source file
+// name, returning the fields it filled. It runs before prepareMeta, and
+// before lyrics are looked up by title.
+func (b *batch) fillMissing(p string, meta *ncm.Meta, metaErr error) []string {
+	if !ncm.NeedsFallback(meta, metaErr) {
+		return nil
 	}
+	return ncm.InferMeta(meta, p, b.fallback)
+}
 
-	// Wait for all goroutines, then send a system notification
-	go func() {
-		wg.Wait()
-		d := int(doneN.Load())
-		e := int(errorN.Load())
-		sendNotification(d, e, total)
-	}()
+// prepareMeta applies the metadata adjustments configured for the batch. It
+// runs on every Meta before file names or tags are built from it, so
+// previews, planned paths and written tags agree. Script conversion runs
+// first so rewrite rules see one consistent script.
+func (b *batch) prepareMeta(meta *ncm.Meta) {
+	meta.ConvertScript(b.script)
+	b.rewriter.Apply(meta)
 }
 
-// convertOne processes a single NCM file and emits progress events.
-func (a *App) convertOne(p, outputDir, pattern string, doneN, errorN *atomic.Int32) {
-	emit := func(ev ConvertProgress) {
-		wailsRuntime.EventsEmit(a.ctx, EventConvertProgress, ev)
+// templateData returns the filename template input for the index-th file (1-based).
+func (b *batch) templateData(p string, index int, meta *ncm.Meta, format string) ncm.TemplateData {
+	return ncm.TemplateData{
+		Meta:       meta,
+		Format:     format,
+		SourcePath: p,
+		Index:      index,
+		Total:      b.total,
+		Sanitize:   b.sanitize,
 	}
+}
+
+// convertOne converts the file of job j, a job of batch b, and emits its
+// progress events. It stops when ctx is cancelled.
+func (a *App) convertOne(ctx context.Context, j *Job, b *batch) {
+	p, index := j.Path, j.Index
+	emit := func(ev ConvertProgress) { a.record(j, ev) }
 
 	// Read file size
 	var fileSize int64
@@ -126,100 +329,251 @@ func (a *App) convertOne(p, outputDir, pattern string, doneN, errorN *atomic.Int
 		fileSize = fi.Size()
 	}
 
+	cancelled := func() {
+		emit(ConvertProgress{Path: p, Status: StatusCancelled, Size: fileSize})
+	}
+
 	// Emit "converting" immediately so frontend shows the row as active
-	emit(ConvertProgress{Path: p, Status: "converting", Size: fileSize, Progress: 0})
+	emit(ConvertProgress{Path: p, Status: StatusConverting, Size: fileSize, Progress: 0})
 
 	// Determine output dir
-	outDir := outputDir
-	if outDir == "" {
-		outDir = filepath.Dir(p)
-	}
+	outDir := b.outDirFor(p)
 	if err := os.MkdirAll(outDir, 0755); err != nil {
-		emit(ConvertProgress{Path: p, Status: "error", Error: "无法创建输出目录: " + err.Error()})
-		errorN.Add(1)
+		emit(ConvertProgress{Path: p, Status: StatusError, Error: "无法创建输出目录: " + err.Error()})
 		return
 	}
 
+	progress := &progressTracker{path: p, size: fileSize, emit: emit}
+
 	// Decrypt
-	result, err := ncm.DecryptFile(p)
+	result, err := ncm.DecryptFileContext(ctx, p, progress.report)
+	if ctx.Err() != nil {
+		cancelled()
+		return
+	}
 	if err != nil {
-		emit(ConvertProgress{Path: p, Status: "error", Error: err.Error()})
-		errorN.Add(1)
+		emit(ConvertProgress{Path: p, Status: StatusError, Error: err.Error()})
 		return
 	}
 
-	// Write with progress callback — throttle to avoid flooding the event bus
-	// (emit at most once per ~1% change using a simple threshold)
-	var lastPct float64
-	progressFn := func(pct float64) {
-		if pct-lastPct >= 0.01 || pct >= 1.0 {
-			lastPct = pct
-			emit(ConvertProgress{
-				Path:     p,
-				Status:   "converting",
-				Size:     fileSize,
-				Progress: pct,
-			})
+	inferred := b.fillMissing(p, result.Meta, result.MetaErr)
+	// Enrichment is best-effort: a failed lookup is reported, not fatal
+	song, enrichErr := b.enrich(ctx, result.Meta)
+	if song != nil && song.CoverURL != "" {
+		// The server's cover is the full-size original; NCM embeds a smaller one
+		progress.report(ncm.StageProgress{Stage: ncm.StageFetchingCover, Done: 0, Total: 1})
+		if cover, err := b.covers.FetchContext(ctx, song.CoverURL); err == nil {
+			result.CoverData = cover
 		}
+		progress.report(ncm.StageProgress{Stage: ncm.StageFetchingCover, Done: 1, Total: 1})
+	}
+	// Lyrics are looked up by the names as stored, before any conversion
+	songLrc := findLyrics(b.lyrics, p, result.Meta, song)
+	mb := b.matchMusicBrainz(ctx, result.Meta)
+	b.prepareMeta(result.Meta)
+	embedLrc := songLrc.toEmbed()
+
+	// Earlier files of the batch get the first pick of names
+	if b.waitPlanned(ctx, index) != nil {
+		cancelled()
+		return
+	}
+	outPath, err := ncm.WriteToFileContext(ctx, result, outDir, ncm.WriteOptions{
+		FilenamePattern: b.pattern,
+		Sanitize:        b.sanitize,
+		Cover:           b.cover,
+		CoverSidecar:    b.sidecar,
+		CoverFetcher:    b.covers,
+		Collision:       b.collision,
+		Reservations:    b.reservations,
+		Owner:           j.ID,
+		SourcePath:      p,
+		Index:           index,
+		Total:           b.total,
+		Lyrics:          embedLrc,
+		Report:          progress.report,
+	})
+	if errors.Is(err, ncm.ErrSkipped) {
+		emit(ConvertProgress{Path: p, Status: StatusSkipped, Size: fileSize, Progress: 1.0, OutputPath: outPath, Inferred: inferred})
+		return
+	}
+	// Lookups cut short by the cancellation end up here too; the writer
+	// removed any partial output
+	if ctx.Err() != nil {
+		cancelled()
+		return
 	}
-
-	outPath, err := ncm.WriteToFileWithProgress(result, outDir, pattern, progressFn)
 	if err != nil {
-		emit(ConvertProgress{Path: p, Status: "error", Error: err.Error()})
-		errorN.Add(1)
+		emit(ConvertProgress{Path: p, Status: StatusError, Error: err.Error()})
 		return
 	}
 
-	emit(ConvertProgress{Path: p, Status: "done", Size: fileSize, Progress: 1.0, OutputPath: outPath})
-	tryLrcCopy(p, outputDir) // copy .lrc sidecar if feature is enabled
-	doneN.Add(1)
+	lyr := songLrc.finish(outPath, embedLrc != nil) // write .lrc sidecar if enabled
+	ev := ConvertProgress{
+		Path:        p,
+		Status:      StatusDone,
+		Size:        fileSize,
+		Progress:    1.0,
+		OutputPath:  outPath,
+		Lyrics:      lyr,
+		Inferred:    inferred,
+		Enriched:    song != nil,
+		MusicBrainz: mb,
+	}
+	if enrichErr != nil {
+		ev.EnrichError = enrichErr.Error()
+	}
+	emit(ev)
 }
 
 // sendNotification shows a system toast/notification when conversion finishes.
-func sendNotification(done, errors, total int) {
+func sendNotification(done, skipped, errors, cancelled, total int) {
 	title := "PureNCM — 转换完成"
 	var msg string
 	switch {
+	case cancelled == total:
+		title = "PureNCM — 转换已取消"
+		msg = fmt.Sprintf("已取消全部 %d 个文件", total)
+		cancelled = 0 // already said
 	case errors == 0:
 		msg = fmt.Sprintf("成功转换 %d 个文件", done)
-	case done == 0:
+	case done == 0 && skipped == 0 && cancelled == 0:
 		msg = fmt.Sprintf("全部 %d 个文件转换失败", total)
 	default:
 		msg = fmt.Sprintf("完成 %d / %d，失败 %d 个", done, total, errors)
 	}
+	if skipped > 0 {
+		msg += fmt.Sprintf("，跳过 %d 个已存在文件", skipped)
+	}
+	if cancelled > 0 {
+		msg += fmt.Sprintf("，已取消 %d 个", cancelled)
+	}
 	_ = beeep.Notify(title, msg, "")
 }
 
-// tryLrcCopy copies a .lrc sidecar next to the source .ncm into the output directory.
-// It is a no-op when: config.CopyLrc is false, outputDir is empty,
-// or there is no matching .lrc file.
-func tryLrcCopy(srcNCM, outputDir string) {
-	if outputDir == "" {
-		return // no explicit output dir — lrc would stay next to source anyway
+// --- Helpers ---
+
+// tempJournalName is the file under the config dir listing in-progress writes.
+const tempJournalName = "pending-writes.txt"
+
+// sweepTempFiles removes partial outputs left by a crashed session, looking
+// in the output dir and dirs, and starts journaling new ones. It returns the
+// number of files removed. Failures are non-fatal.
+func sweepTempFiles(dirs ...string) int {
+	dir, err := config.Dir()
+	if err != nil {
+		return 0
 	}
-	if !config.Get().CopyLrc {
-		return
+	removed, _ := ncm.InitTempJournal(filepath.Join(dir, tempJournalName), append(dirs, config.Get().OutputDir)...)
+	return removed
+}
+
+// progressTracker turns stage reports for one file into "converting"
+// events, throttled to one per ~1% of overall progress plus one at each
+// stage change.
+type progressTracker struct {
+	path string
+	size int64
+	emit func(ConvertProgress)
+
+	stage      ncm.Stage
+	stageStart time.Time
+	last       float64 // overall progress last emitted
+}
+
+func (t *progressTracker) report(sp ncm.StageProgress) {
+	now := time.Now()
+	overall := sp.Overall()
+	if sp.Stage == t.stage {
+		if overall-t.last < 0.01 && sp.Done < sp.Total {
+			return
+		}
+	} else {
+		t.stage, t.stageStart = sp.Stage, now
 	}
-	// Look for a .lrc file with the same base name as the ncm
-	lrcSrc := srcNCM[:len(srcNCM)-len(".ncm")] + ".lrc"
-	if _, err := os.Stat(lrcSrc); err != nil {
-		return // no .lrc found — skip silently
+	t.last = overall
+
+	ev := ConvertProgress{
+		Path:          t.path,
+		Status:        StatusConverting,
+		Size:          t.size,
+		Progress:      overall,
+		Stage:         string(sp.Stage),
+		StageProgress: sp.Fraction(),
 	}
-	lrcDst := filepath.Join(outputDir, filepath.Base(lrcSrc))
-	src, err := os.Open(lrcSrc)
-	if err != nil {
-		return
+	if sp.Total > 1 { // a byte count rather than a 0/1 marker
+		ev.Bytes = sp.Done
+		if secs := now.Sub(t.stageStart).Seconds(); secs > 0 {
+			ev.BytesPerSec = float64(sp.Done) / secs
+		}
 	}
-	defer src.Close()
-	dst, err := os.Create(lrcDst)
-	if err != nil {
-		return
+	t.emit(ev)
+}
+
+// coverCacheDir is the cover cache under config.CacheDir.
+const coverCacheDir = "covers"
+
+// coverFetcher returns the cover downloader for a batch. Without a cache
+// directory covers are still downloaded, just not kept.
+func coverFetcher(cfg *config.Config) *ncm.CoverFetcher {
+	f := &ncm.CoverFetcher{Client: httpClient(), Offline: cfg.Offline}
+	if dir, err := config.CacheDir(); err == nil {
+		f.CacheDir = filepath.Join(dir, coverCacheDir)
 	}
-	defer dst.Close()
-	_, _ = io.Copy(dst, src)
+	return f
 }
 
-// --- Helpers ---
+// coverOptions maps the persisted cover settings onto ncm.CoverOptions.
+func coverOptions(c config.CoverConfig) ncm.CoverOptions {
+	return ncm.CoverOptions{
+		MaxDimension:  c.MaxDimension,
+		JPEGQuality:   c.JPEGQuality,
+		MaxBytes:      c.MaxBytes,
+		ConvertToJPEG: c.ConvertToJPEG,
+	}
+}
+
+// fallbackPatterns compiles the persisted fallback patterns, skipping
+// invalid ones from hand-edited configs.
+func fallbackPatterns(patterns []string) []*ncm.FallbackPattern {
+	var out []*ncm.FallbackPattern
+	for _, p := range patterns {
+		if fp, err := ncm.ParseFallbackPattern(p); err == nil {
+			out = append(out, fp)
+		}
+	}
+	return out
+}
+
+// sanitizeOptions maps the persisted filename settings onto ncm.SanitizeOptions.
+func sanitizeOptions(c config.FilenameConfig) ncm.SanitizeOptions {
+	opts := ncm.SanitizeOptions{
+		Target:        ncm.SanitizeTarget(c.Target),
+		MaxBytes:      c.MaxBytes,
+		Transliterate: c.Transliterate,
+	}
+	for from, to := range c.Replacements {
+		if r, size := utf8.DecodeRuneInString(from); size > 0 && size == len(from) {
+			if opts.Replacements == nil {
+				opts.Replacements = map[rune]string{}
+			}
+			opts.Replacements[r] = to
+		}
+	}
+	return opts
+}
+
+// coverSidecarOptions returns the sidecar settings, or zero options when disabled.
+func coverSidecarOptions(c config.CoverConfig) ncm.CoverSidecarOptions {
+	if !c.Sidecar {
+		return ncm.CoverSidecarOptions{}
+	}
+	return ncm.CoverSidecarOptions{
+		Filename:  c.SidecarName,
+		Overwrite: c.SidecarOverwrite,
+		NoEmbed:   c.SidecarOnly,
+	}
+}
 
 func defaultOutputDir() string {
 	home, err := os.UserHomeDir()
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"PureNCM/internal/ncm"
+)
+
+func TestProgressTracker(t *testing.T) {
+	tests := []struct {
+		name    string
+		reports []ncm.StageProgress
+		want    []string // "stage fraction" of each event sent
+	}{
+		{
+			name: "cover fetch start and end",
+			reports: []ncm.StageProgress{
+				{Stage: ncm.StageFetchingCover, Done: 0, Total: 1},
+				{Stage: ncm.StageFetchingCover, Done: 1, Total: 1},
+			},
+			want: []string{"fetchingCover 0", "fetchingCover 1"},
+		},
+		{
+			name: "small steps are throttled",
+			reports: []ncm.StageProgress{
+				{Stage: ncm.StageWriting, Done: 1, Total: 1000},
+				{Stage: ncm.StageWriting, Done: 2, Total: 1000},
+				{Stage: ncm.StageWriting, Done: 500, Total: 1000},
+				{Stage: ncm.StageWriting, Done: 1000, Total: 1000},
+			},
+			want: []string{"writing 0.001", "writing 0.5", "writing 1"},
+		},
+		{
+			name: "stage changes are always sent",
+			reports: []ncm.StageProgress{
+				{Stage: ncm.StageReading, Done: 100, Total: 100},
+				{Stage: ncm.StageDecrypting, Done: 0, Total: 100},
+				{Stage: ncm.StageTagging, Done: 0, Total: 1},
+			},
+			want: []string{"reading 1", "decrypting 0", "tagging 0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []ConvertProgress
+			pt := &progressTracker{path: "a.ncm", size: 1000, emit: func(ev ConvertProgress) { got = append(got, ev) }}
+			for _, r := range tt.reports {
+				pt.report(r)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("%d events, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i, ev := range got {
+				var stage string
+				var frac float64
+				if _, err := fmt.Sscanf(tt.want[i], "%s %g", &stage, &frac); err != nil {
+					t.Fatal(err)
+				}
+				if ev.Stage != stage || ev.StageProgress != frac || ev.Status != StatusConverting || ev.Path != "a.ncm" {
+					t.Errorf("event %d = %+v, want %s", i, ev, tt.want[i])
+				}
+			}
+		})
+	}
+}
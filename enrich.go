@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"PureNCM/internal/config"
+	"PureNCM/internal/ncm"
+	"PureNCM/internal/netease"
+)
+
+// neteaseCacheDir is the song details cache under config.CacheDir.
+const neteaseCacheDir = "netease"
+
+// SetNeteaseAPI validates and saves the enrichment server's base URL. An
+// empty URL turns enrichment off.
+func (a *App) SetNeteaseAPI(baseURL string) error {
+	baseURL = strings.TrimSpace(baseURL)
+	if baseURL != "" {
+		if err := netease.ValidateBaseURL(baseURL); err != nil {
+			return fmt.Errorf("API 地址无效：%v", err)
+		}
+	}
+	return config.SetNeteaseAPI(baseURL)
+}
+
+// neteaseClient returns the enrichment client for a batch, or nil when
+// enrichment is off.
+func neteaseClient(cfg *config.Config) *netease.Client {
+	if cfg.NeteaseAPI == "" {
+		return nil
+	}
+	c := &netease.Client{BaseURL: cfg.NeteaseAPI, HTTP: httpClient(), Offline: cfg.Offline}
+	if dir, err := config.CacheDir(); err == nil {
+		c.CacheDir = filepath.Join(dir, neteaseCacheDir)
+	}
+	return c
+}
+
+// enrich looks the song up on the enrichment server and fills the fields
+// meta lacks. Values already present, e.g. a track number from the file
+// name, are kept. It returns nil without error when enrichment is off or
+// the song has no ID.
+func (b *batch) enrich(ctx context.Context, meta *ncm.Meta) (*netease.Song, error) {
+	if b.netease == nil || meta.MusicID == "" {
+		return nil, nil
+	}
+	song, err := b.netease.Lookup(ctx, string(meta.MusicID))
+	if err != nil {
+		return nil, err
+	}
+	if meta.Track == 0 {
+		meta.Track = song.Track
+	}
+	if meta.Disc == 0 {
+		meta.Disc = song.Disc
+	}
+	if meta.Year == 0 {
+		meta.Year = song.Year
+	}
+	if meta.AlbumArtist == "" {
+		meta.AlbumArtist = song.AlbumArtist
+	}
+	return song, nil
+}
@@ -1,62 +1,232 @@
 import { onMounted, onUnmounted } from 'vue'
 import { EventsOn, EventsOff } from '../../wailsjs/runtime/runtime'
-import { ConvertFiles } from '../../wailsjs/go/main/App'
-import { useFiles } from '@/composables/useFiles'
+import {
+    Enqueue, GetQueue, GetQueueState, Remove, Reorder, RetryFailed,
+} from '../../wailsjs/go/main/App'
+import { main } from '../../wailsjs/go/models'
+import { useFiles, type FileItem } from '@/composables/useFiles'
 import { useConfig } from '@/composables/useConfig'
 
 const EVENT_PROGRESS = 'ncm:progress'
+const EVENT_QUEUE = 'ncm:queue'
 
 interface ProgressPayload {
+    jobId: string
+    batchId: string
     path: string
-    status: 'converting' | 'done' | 'error'
+    status: 'converting' | 'done' | 'skipped' | 'error' | 'cancelled'
     size?: number
     progress?: number
+    stage?: string
+    stageProgress?: number
+    bytes?: number
+    bytesPerSec?: number
     outputPath?: string
     error?: string
+    lyrics?: LyricsResult
+    inferred?: string[]   // fields taken from the file name
+    enriched?: boolean    // details filled in from the NetEase API
+    enrichError?: string
+    musicbrainz?: { recordingId?: string, score?: number, error?: string }
+}
+
+interface QueueStatePayload {
+    running: boolean
+    paused: boolean
+    batches: string[]   // IDs of the batches with unfinished jobs
+}
+
+interface LyricsResult {
+    source?: string
+    encoding?: string
+    embedded: boolean
+    sidecar?: string
+    error?: string
+}
+
+function describeLyrics(l: LyricsResult): string {
+    if (l.error) return `歌词：${l.error}`
+    if (!l.source) return '未找到歌词'
+    const parts: string[] = []
+    if (l.embedded) parts.push('已内嵌')
+    if (l.sidecar) parts.push('已写入 .lrc')
+    const enc = l.encoding && l.encoding !== 'UTF-8' ? `（${l.encoding} → UTF-8）` : ''
+    return `歌词：${parts.join('、') || '已找到'}${enc}`
+}
+
+const fieldLabels: Record<string, string> = { title: '标题', artist: '歌手', album: '专辑', track: '音轨号' }
+
+function describeInferred(fields: string[]): string {
+    return `已从文件名推断：${fields.map(f => fieldLabels[f] ?? f).join('、')}`
+}
+
+function describeMusicBrainz(mb: NonNullable<ProgressPayload['musicbrainz']>): string {
+    if (mb.error) return `MusicBrainz：${mb.error}`
+    if (!mb.recordingId) return 'MusicBrainz：无可信匹配'
+    return `MusicBrainz：已匹配（${mb.score}%）`
+}
+
+// applyProgress updates item from a progress event, or from the final event
+// a finished job keeps as its result.
+function applyProgress(item: FileItem, payload: ProgressPayload) {
+    item.status = payload.status
+    if (payload.size && payload.size > 0) {
+        item.size = payload.size
+    }
+    if (payload.progress !== undefined) {
+        item.progress = payload.progress
+    }
+    item.stage = payload.status === 'converting' ? payload.stage : undefined
+    item.bytesPerSec = payload.status === 'converting' ? payload.bytesPerSec : undefined
+    if (payload.status === 'error') {
+        item.error = payload.error ?? '未知错误'
+        item.progress = 0
+    } else if (payload.status === 'cancelled') {
+        item.error = undefined
+        item.note = undefined
+        item.progress = 0
+    } else if (payload.status === 'skipped') {
+        item.error = undefined
+        item.progress = 1
+        const notes: string[] = []
+        if (payload.outputPath) notes.push(`已存在：${payload.outputPath}`)
+        if (payload.inferred?.length) notes.push(describeInferred(payload.inferred))
+        item.note = notes.join('；') || undefined
+    } else if (payload.status === 'done') {
+        item.error = undefined
+        item.progress = 1
+        const notes: string[] = []
+        if (payload.inferred?.length) notes.push(describeInferred(payload.inferred))
+        if (payload.enriched) notes.push('已在线补全信息')
+        if (payload.enrichError) notes.push(`在线补全失败：${payload.enrichError}`)
+        if (payload.musicbrainz) notes.push(describeMusicBrainz(payload.musicbrainz))
+        if (payload.lyrics) notes.push(describeLyrics(payload.lyrics))
+        item.note = notes.join('；') || undefined
+    }
+}
+
+// applyQueue replaces the queued items with the jobs from GetQueue, keeping
+// the files not yet enqueued after them.
+function applyQueue(jobs: main.Job[]) {
+    const { files, newItem } = useFiles()
+    const known = new Map(files.value.filter(f => f.jobId).map(f => [f.jobId, f]))
+    const queued = jobs.map(job => {
+        const item = known.get(job.id) ?? newItem(job.path, job.id)
+        item.jobId = job.id
+        item.batchId = job.batchId
+        item.status = job.status as FileItem['status']
+        item.size = job.size
+        item.progress = job.progress
+        if (job.result) {
+            applyProgress(item, job.result as ProgressPayload)
+        } else {
+            item.error = item.note = undefined
+        }
+        return item
+    })
+    files.value = [...queued, ...files.value.filter(f => !f.jobId)]
+}
+
+let refreshing: Promise<void> | null = null
+let refreshAgain = false
+
+// refreshQueue syncs the list from the Go queue. Calls made while a refresh
+// is in flight run one more refresh after it, so the list never ends on a
+// snapshot older than the latest change.
+export async function refreshQueue() {
+    if (refreshing) {
+        refreshAgain = true
+        return refreshing
+    }
+    refreshing = (async () => {
+        do {
+            refreshAgain = false
+            applyQueue(await GetQueue())
+        } while (refreshAgain)
+    })()
+    try {
+        await refreshing
+    } finally {
+        refreshing = null
+    }
+}
+
+// removeItem takes a file off the list, and out of the queue once enqueued.
+export async function removeItem(item: FileItem) {
+    if (!item.jobId) {
+        useFiles().removeFile(item.id)
+        return
+    }
+    await Remove(item.jobId)
+    await refreshQueue()
+}
+
+// clearList removes every file that is not being converted.
+export async function clearList() {
+    const { files } = useFiles()
+    for (const f of files.value.filter(f => f.status !== 'converting')) {
+        await removeItem(f)
+    }
+}
+
+// moveToFront makes a queued file the next one to start.
+export async function moveToFront(item: FileItem) {
+    if (!item.jobId) return
+    await Reorder(item.jobId, 0)
+    await refreshQueue()
+}
+
+// retryFailed requeues the files that failed or were cancelled.
+export async function retryFailed() {
+    await RetryFailed()
+    await refreshQueue()
 }
 
 export function useConvert() {
-    const { files, isConverting } = useFiles()
+    const { files, queueRunning, isPaused } = useFiles()
     const { config } = useConfig()
 
+    // Enqueues the listed files as a new batch; it runs alongside any batch
+    // already in progress
     const startConvert = async () => {
-        const pending = files.value.filter(f => f.status === 'pending')
-        if (pending.length === 0 || isConverting.value) return
+        const listed = files.value.filter(f => !f.jobId)
+        if (listed.length === 0) return
 
-        const paths = pending.map(f => f.path)
+        const paths = listed.map(f => f.path)
         const outputDir = config.value.outputDir
         const pattern = config.value.filenamePattern || '{title}'
 
-        // Fire-and-forget: Go runs synchronously on its goroutine and emits events
-        ConvertFiles(paths, outputDir, pattern)
+        await Enqueue(paths, outputDir, pattern)
+        files.value = files.value.filter(f => f.jobId || !paths.includes(f.path))
+        await refreshQueue()
     }
 
     const handleProgress = (payload: ProgressPayload) => {
-        const item = files.value.find(f => f.path === payload.path)
-        if (!item) return
-
-        item.status = payload.status
-        if (payload.size && payload.size > 0) {
-            item.size = payload.size
-        }
-        if (payload.progress !== undefined) {
-            item.progress = payload.progress
-        }
-        if (payload.status === 'error') {
-            item.error = payload.error ?? '未知错误'
-            item.progress = 0
-        } else if (payload.status === 'done') {
-            item.error = undefined
-            item.progress = 1
+        const item = files.value.find(f => f.jobId === payload.jobId)
+        if (!item) {
+            // A job this list has not synced yet, e.g. just enqueued
+            refreshQueue()
+            return
         }
+        applyProgress(item, payload)
+    }
+
+    const handleQueueState = (payload: QueueStatePayload) => {
+        queueRunning.value = payload.running
+        isPaused.value = payload.paused
     }
 
-    onMounted(() => {
+    onMounted(async () => {
         EventsOn(EVENT_PROGRESS, handleProgress)
+        EventsOn(EVENT_QUEUE, handleQueueState)
+        // After a frontend reload the queue may already hold jobs
+        handleQueueState(await GetQueueState())
+        await refreshQueue()
     })
 
     onUnmounted(() => {
         EventsOff(EVENT_PROGRESS)
+        EventsOff(EVENT_QUEUE)
     })
 
     return { startConvert }
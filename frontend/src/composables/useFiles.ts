@@ -1,22 +1,39 @@
 import { ref, computed } from 'vue'
 
-export type FileStatus = 'pending' | 'converting' | 'done' | 'error'
+export type FileStatus = 'pending' | 'converting' | 'done' | 'skipped' | 'error' | 'cancelled'
 
 export interface FileItem {
-    id: string
+    id: string         // the job ID once queued
+    jobId?: string     // set once the file is in the Go queue; unset while only listed here
+    batchId?: string
     path: string
     name: string
     size: number
     status: FileStatus
-    progress: number   // 0–1 write progress (only meaningful when status==='converting')
+    progress: number   // 0–1 across all stages (only meaningful when status==='converting')
+    stage?: string     // current step while converting, e.g. 'decrypting'
+    bytesPerSec?: number
     error?: string
+    note?: string      // informational message, e.g. lyrics outcome
 }
 
+// Files are listed here until they are enqueued. From then on the Go queue
+// owns them: useConvert syncs the queued items from GetQueue and the events.
 const files = ref<FileItem[]>([])
 
+// Queue state from the "ncm:queue" event, see useConvert
+const queueRunning = ref(false)
+const isPaused = ref(false)
+
 let _idCounter = 0
 function genId() { return `f-${++_idCounter}` }
 
+function newItem(path: string, id = genId()): FileItem {
+    // Extract filename — strip trailing separators first to handle "C:\path\" style paths
+    const name = path.replace(/[\\/]+$/, '').split(/[\\/]/).pop() || path
+    return { id, path, name, size: 0, progress: 0, status: 'pending' }
+}
+
 function formatBytes(bytes: number): string {
     if (bytes < 1024) return `${bytes} B`
     if (bytes < 1024 * 1024) return `${(bytes / 1024).toFixed(1)} KB`
@@ -28,46 +45,32 @@ export function useFiles() {
         const existing = new Set(files.value.map(f => f.path))
         for (const p of paths) {
             if (existing.has(p)) continue
-            // Extract filename — strip trailing separators first to handle "C:\path\" style paths
-            const name = p.replace(/[\\/]+$/, '').split(/[\\/]/).pop() || p
-
-            files.value.push({
-                id: genId(),
-                path: p,
-                name,
-                size: 0,
-                progress: 0,
-                status: 'pending',
-            })
-
+            files.value.push(newItem(p))
         }
     }
 
+    // Queued files are removed through the queue, see useConvert
     const removeFile = (id: string) => {
-        files.value = files.value.filter(f => f.id !== id)
-    }
-
-    const clearAll = () => {
-        files.value = []
-    }
-
-    const clearDone = () => {
-        files.value = files.value.filter(f => f.status !== 'done' && f.status !== 'error')
+        files.value = files.value.filter(f => f.id !== id || f.jobId)
     }
 
-    const pendingCount = computed(() => files.value.filter(f => f.status === 'pending').length)
+    const pendingCount = computed(() => files.value.filter(f => !f.jobId).length)
+    const failedCount = computed(() => files.value.filter(f => f.status === 'error' || f.status === 'cancelled').length)
     const hasFiles = computed(() => files.value.length > 0)
-    const isConverting = computed(() => files.value.some(f => f.status === 'converting'))
+    // A paused batch may have no file in progress, only queued ones
+    const isConverting = computed(() => queueRunning.value || files.value.some(f => f.status === 'converting'))
 
     return {
         files,
         addPaths,
         removeFile,
-        clearAll,
-        clearDone,
         pendingCount,
+        failedCount,
         hasFiles,
         isConverting,
+        queueRunning,
+        isPaused,
         formatBytes,
+        newItem,
     }
 }
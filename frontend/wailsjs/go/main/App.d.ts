@@ -1,17 +1,78 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 import {config} from '../models';
+import {main} from '../models';
+
+export function CancelConversion():Promise<void>;
+
+export function CancelFile(arg1:string):Promise<void>;
+
+export function CancelJob(arg1:string):Promise<void>;
 
 export function ConvertFiles(arg1:Array<string>,arg2:string,arg3:string):Promise<void>;
 
+export function DiscardQueue():Promise<void>;
+
+export function Enqueue(arg1:Array<string>,arg2:string,arg3:string):Promise<string>;
+
 export function GetConfig():Promise<config.Config>;
 
+export function GetInterruptedQueue():Promise<main.InterruptedQueue>;
+
+export function GetQueue():Promise<Array<main.Job>>;
+
+export function GetQueueState():Promise<main.QueueState>;
+
 export function OpenDirectoryDialog():Promise<string>;
 
 export function OpenFileDialog():Promise<Array<string>>;
 
+export function PauseConversion():Promise<void>;
+
+export function PreviewFilenames(arg1:string,arg2:Array<string>):Promise<Array<main.FilenamePreview>>;
+
+export function Remove(arg1:string):Promise<void>;
+
+export function Reorder(arg1:string,arg2:number):Promise<void>;
+
+export function ResumeConversion():Promise<void>;
+
+export function ResumeQueue():Promise<void>;
+
+export function RetryFailed():Promise<number>;
+
+export function SetChineseConversion(arg1:string):Promise<void>;
+
+export function SetCollisionPolicy(arg1:string):Promise<void>;
+
 export function SetCopyLrc(arg1:boolean):Promise<void>;
 
+export function SetCoverConfig(arg1:config.CoverConfig):Promise<void>;
+
+export function SetFallbackPatterns(arg1:Array<string>):Promise<void>;
+
+export function SetFilenameConfig(arg1:config.FilenameConfig):Promise<void>;
+
 export function SetFilenamePattern(arg1:string):Promise<void>;
 
+export function SetLrcMode(arg1:string):Promise<void>;
+
+export function SetLrcSearchDirs(arg1:Array<string>):Promise<void>;
+
+export function SetLyricsCacheDir(arg1:string):Promise<void>;
+
+export function SetLyricsLayout(arg1:string,arg2:boolean):Promise<void>;
+
+export function SetMusicBrainzConfig(arg1:config.MusicBrainzConfig):Promise<void>;
+
+export function SetNeteaseAPI(arg1:string):Promise<void>;
+
+export function SetNetworkConfig(arg1:config.NetworkConfig):Promise<void>;
+
+export function SetOffline(arg1:boolean):Promise<void>;
+
 export function SetOutputDir(arg1:string):Promise<void>;
+
+export function SetRewriteRules(arg1:Array<config.RewriteRule>):Promise<void>;
+
+export function TestRewriteRule(arg1:config.RewriteRule,arg2:main.RewriteSample):Promise<main.RewriteSample>;
@@ -2,14 +2,46 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function CancelConversion() {
+  return window['go']['main']['App']['CancelConversion']();
+}
+
+export function CancelFile(arg1) {
+  return window['go']['main']['App']['CancelFile'](arg1);
+}
+
+export function CancelJob(arg1) {
+  return window['go']['main']['App']['CancelJob'](arg1);
+}
+
 export function ConvertFiles(arg1, arg2, arg3) {
   return window['go']['main']['App']['ConvertFiles'](arg1, arg2, arg3);
 }
 
+export function DiscardQueue() {
+  return window['go']['main']['App']['DiscardQueue']();
+}
+
+export function Enqueue(arg1, arg2, arg3) {
+  return window['go']['main']['App']['Enqueue'](arg1, arg2, arg3);
+}
+
 export function GetConfig() {
   return window['go']['main']['App']['GetConfig']();
 }
 
+export function GetInterruptedQueue() {
+  return window['go']['main']['App']['GetInterruptedQueue']();
+}
+
+export function GetQueue() {
+  return window['go']['main']['App']['GetQueue']();
+}
+
+export function GetQueueState() {
+  return window['go']['main']['App']['GetQueueState']();
+}
+
 export function OpenDirectoryDialog() {
   return window['go']['main']['App']['OpenDirectoryDialog']();
 }
@@ -18,14 +50,102 @@ export function OpenFileDialog() {
   return window['go']['main']['App']['OpenFileDialog']();
 }
 
+export function PauseConversion() {
+  return window['go']['main']['App']['PauseConversion']();
+}
+
+export function PreviewFilenames(arg1, arg2) {
+  return window['go']['main']['App']['PreviewFilenames'](arg1, arg2);
+}
+
+export function Remove(arg1) {
+  return window['go']['main']['App']['Remove'](arg1);
+}
+
+export function Reorder(arg1, arg2) {
+  return window['go']['main']['App']['Reorder'](arg1, arg2);
+}
+
+export function ResumeConversion() {
+  return window['go']['main']['App']['ResumeConversion']();
+}
+
+export function ResumeQueue() {
+  return window['go']['main']['App']['ResumeQueue']();
+}
+
+export function RetryFailed() {
+  return window['go']['main']['App']['RetryFailed']();
+}
+
+export function SetChineseConversion(arg1) {
+  return window['go']['main']['App']['SetChineseConversion'](arg1);
+}
+
+export function SetCollisionPolicy(arg1) {
+  return window['go']['main']['App']['SetCollisionPolicy'](arg1);
+}
+
 export function SetCopyLrc(arg1) {
   return window['go']['main']['App']['SetCopyLrc'](arg1);
 }
 
+export function SetCoverConfig(arg1) {
+  return window['go']['main']['App']['SetCoverConfig'](arg1);
+}
+
+export function SetFallbackPatterns(arg1) {
+  return window['go']['main']['App']['SetFallbackPatterns'](arg1);
+}
+
+export function SetFilenameConfig(arg1) {
+  return window['go']['main']['App']['SetFilenameConfig'](arg1);
+}
+
 export function SetFilenamePattern(arg1) {
   return window['go']['main']['App']['SetFilenamePattern'](arg1);
 }
 
+export function SetLrcMode(arg1) {
+  return window['go']['main']['App']['SetLrcMode'](arg1);
+}
+
+export function SetLrcSearchDirs(arg1) {
+  return window['go']['main']['App']['SetLrcSearchDirs'](arg1);
+}
+
+export function SetLyricsCacheDir(arg1) {
+  return window['go']['main']['App']['SetLyricsCacheDir'](arg1);
+}
+
+export function SetLyricsLayout(arg1, arg2) {
+  return window['go']['main']['App']['SetLyricsLayout'](arg1, arg2);
+}
+
+export function SetMusicBrainzConfig(arg1) {
+  return window['go']['main']['App']['SetMusicBrainzConfig'](arg1);
+}
+
+export function SetNeteaseAPI(arg1) {
+  return window['go']['main']['App']['SetNeteaseAPI'](arg1);
+}
+
+export function SetNetworkConfig(arg1) {
+  return window['go']['main']['App']['SetNetworkConfig'](arg1);
+}
+
+export function SetOffline(arg1) {
+  return window['go']['main']['App']['SetOffline'](arg1);
+}
+
 export function SetOutputDir(arg1) {
   return window['go']['main']['App']['SetOutputDir'](arg1);
 }
+
+export function SetRewriteRules(arg1) {
+  return window['go']['main']['App']['SetRewriteRules'](arg1);
+}
+
+export function TestRewriteRule(arg1, arg2) {
+  return window['go']['main']['App']['TestRewriteRule'](arg1, arg2);
+}
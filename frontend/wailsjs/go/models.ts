@@ -1,9 +1,128 @@
 export namespace config {
 	
+	export class CoverConfig {
+	    maxDimension: number;
+	    jpegQuality: number;
+	    maxBytes: number;
+	    convertToJpeg: boolean;
+	    sidecar: boolean;
+	    sidecarName: string;
+	    sidecarOverwrite: boolean;
+	    sidecarOnly: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new CoverConfig(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.maxDimension = source["maxDimension"];
+	        this.jpegQuality = source["jpegQuality"];
+	        this.maxBytes = source["maxBytes"];
+	        this.convertToJpeg = source["convertToJpeg"];
+	        this.sidecar = source["sidecar"];
+	        this.sidecarName = source["sidecarName"];
+	        this.sidecarOverwrite = source["sidecarOverwrite"];
+	        this.sidecarOnly = source["sidecarOnly"];
+	    }
+	}
+	export class FilenameConfig {
+	    target: string;
+	    maxBytes: number;
+	    replacements: {[key: string]: string};
+	    transliterate: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new FilenameConfig(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.target = source["target"];
+	        this.maxBytes = source["maxBytes"];
+	        this.replacements = source["replacements"];
+	        this.transliterate = source["transliterate"];
+	    }
+	}
+	export class MusicBrainzConfig {
+	    enabled: boolean;
+	    baseUrl: string;
+	    rateLimitMs: number;
+	    minScore: number;
+	    canonical: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new MusicBrainzConfig(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.enabled = source["enabled"];
+	        this.baseUrl = source["baseUrl"];
+	        this.rateLimitMs = source["rateLimitMs"];
+	        this.minScore = source["minScore"];
+	        this.canonical = source["canonical"];
+	    }
+	}
+	export class NetworkConfig {
+	    proxyMode: string;
+	    proxyUrl: string;
+	    timeoutSeconds: number;
+	    retries: number;
+	    maxConcurrent: number;
+	    userAgent: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new NetworkConfig(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.proxyMode = source["proxyMode"];
+	        this.proxyUrl = source["proxyUrl"];
+	        this.timeoutSeconds = source["timeoutSeconds"];
+	        this.retries = source["retries"];
+	        this.maxConcurrent = source["maxConcurrent"];
+	        this.userAgent = source["userAgent"];
+	    }
+	}
+	export class RewriteRule {
+	    field: string;
+	    action: string;
+	    pattern: string;
+	    replace: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new RewriteRule(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.field = source["field"];
+	        this.action = source["action"];
+	        this.pattern = source["pattern"];
+	        this.replace = source["replace"];
+	    }
+	}
 	export class Config {
 	    outputDir: string;
 	    filenamePattern: string;
 	    copyLrc: boolean;
+	    collisionPolicy: string;
+	    lrcMode: string;
+	    lrcSearchDirs: string[];
+	    lyricsCacheDir: string;
+	    lyricsLayout: string;
+	    lyricsRomaji: boolean;
+	    chineseConversion: string;
+	    rewriteRules: RewriteRule[];
+	    fallbackPatterns: string[];
+	    offline: boolean;
+	    neteaseApi: string;
+	    cover: CoverConfig;
+	    filename: FilenameConfig;
+	    network: NetworkConfig;
+	    musicBrainz: MusicBrainzConfig;
 	
 	    static createFrom(source: any = {}) {
 	        return new Config(source);
@@ -14,6 +133,251 @@ export namespace config {
 	        this.outputDir = source["outputDir"];
 	        this.filenamePattern = source["filenamePattern"];
 	        this.copyLrc = source["copyLrc"];
+	        this.collisionPolicy = source["collisionPolicy"];
+	        this.lrcMode = source["lrcMode"];
+	        this.lrcSearchDirs = source["lrcSearchDirs"];
+	        this.lyricsCacheDir = source["lyricsCacheDir"];
+	        this.lyricsLayout = source["lyricsLayout"];
+	        this.lyricsRomaji = source["lyricsRomaji"];
+	        this.chineseConversion = source["chineseConversion"];
+	        this.rewriteRules = this.convertValues(source["rewriteRules"], RewriteRule);
+	        this.fallbackPatterns = source["fallbackPatterns"];
+	        this.offline = source["offline"];
+	        this.neteaseApi = source["neteaseApi"];
+	        this.cover = this.convertValues(source["cover"], CoverConfig);
+	        this.filename = this.convertValues(source["filename"], FilenameConfig);
+	        this.network = this.convertValues(source["network"], NetworkConfig);
+	        this.musicBrainz = this.convertValues(source["musicBrainz"], MusicBrainzConfig);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+}
+export namespace main {
+	
+	export class LyricsResult {
+	    source?: string;
+	    encoding?: string;
+	    embedded: boolean;
+	    sidecar?: string;
+	    error?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new LyricsResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.source = source["source"];
+	        this.encoding = source["encoding"];
+	        this.embedded = source["embedded"];
+	        this.sidecar = source["sidecar"];
+	        this.error = source["error"];
+	    }
+	}
+	export class MusicBrainzResult {
+	    recordingId?: string;
+	    score?: number;
+	    error?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new MusicBrainzResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.recordingId = source["recordingId"];
+	        this.score = source["score"];
+	        this.error = source["error"];
+	    }
+	}
+	export class ConvertProgress {
+	    jobId: string;
+	    batchId: string;
+	    path: string;
+	    status: string;
+	    size: number;
+	    progress: number;
+	    outputPath: string;
+	    error: string;
+	    stage?: string;
+	    stageProgress?: number;
+	    bytes?: number;
+	    bytesPerSec?: number;
+	    lyrics?: LyricsResult;
+	    enriched?: boolean;
+	    enrichError?: string;
+	    musicbrainz?: MusicBrainzResult;
+	    inferred?: string[];
+	
+	    static createFrom(source: any = {}) {
+	        return new ConvertProgress(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.jobId = source["jobId"];
+	        this.batchId = source["batchId"];
+	        this.path = source["path"];
+	        this.status = source["status"];
+	        this.size = source["size"];
+	        this.progress = source["progress"];
+	        this.outputPath = source["outputPath"];
+	        this.error = source["error"];
+	        this.stage = source["stage"];
+	        this.stageProgress = source["stageProgress"];
+	        this.bytes = source["bytes"];
+	        this.bytesPerSec = source["bytesPerSec"];
+	        this.lyrics = this.convertValues(source["lyrics"], LyricsResult);
+	        this.enriched = source["enriched"];
+	        this.enrichError = source["enrichError"];
+	        this.musicbrainz = this.convertValues(source["musicbrainz"], MusicBrainzResult);
+	        this.inferred = source["inferred"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class FilenamePreview {
+	    path: string;
+	    output: string;
+	    warnings?: string[];
+	    error?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new FilenamePreview(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.path = source["path"];
+	        this.output = source["output"];
+	        this.warnings = source["warnings"];
+	        this.error = source["error"];
+	    }
+	}
+	export class InterruptedQueue {
+	    jobs: number;
+	    remaining: number;
+	    cleanedUp: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new InterruptedQueue(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.jobs = source["jobs"];
+	        this.remaining = source["remaining"];
+	        this.cleanedUp = source["cleanedUp"];
+	    }
+	}
+	export class Job {
+	    id: string;
+	    batchId: string;
+	    path: string;
+	    index: number;
+	    status: string;
+	    size: number;
+	    progress: number;
+	    result?: ConvertProgress;
+	
+	    static createFrom(source: any = {}) {
+	        return new Job(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.batchId = source["batchId"];
+	        this.path = source["path"];
+	        this.index = source["index"];
+	        this.status = source["status"];
+	        this.size = source["size"];
+	        this.progress = source["progress"];
+	        this.result = this.convertValues(source["result"], ConvertProgress);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class QueueState {
+	    running: boolean;
+	    paused: boolean;
+	    batches: string[];
+	
+	    static createFrom(source: any = {}) {
+	        return new QueueState(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.running = source["running"];
+	        this.paused = source["paused"];
+	        this.batches = source["batches"];
+	    }
+	}
+	export class RewriteSample {
+	    title: string;
+	    artists: string[];
+	    album: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new RewriteSample(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.title = source["title"];
+	        this.artists = source["artists"];
+	        this.album = source["album"];
 	    }
 	}
 
@@ -0,0 +1,133 @@
+// Package chinese converts text between Simplified and Traditional Chinese
+// with OpenCC-style dictionaries embedded in the binary: phrases are matched
+// first (longest match wins), then single characters, then regional terms and
+// variants. The tables in dict/ are checked in; see gen.go for how they are
+// built.
+package chinese
+
+import (
+	"bufio"
+	"bytes"
+	"embed"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Conversion selects the target script.
+type Conversion string
+
+const (
+	None Conversion = ""     // leave text unchanged
+	S2T  Conversion = "s2t"  // Simplified → Traditional
+	T2S  Conversion = "t2s"  // Traditional → Simplified
+	S2TW Conversion = "s2tw" // Simplified → Traditional, Taiwan forms and terms
+	S2HK Conversion = "s2hk" // Simplified → Traditional, Hong Kong forms
+)
+
+// Valid reports whether c is a known conversion (None included).
+func Valid(c Conversion) bool {
+	switch c {
+	case None, S2T, T2S, S2TW, S2HK:
+		return true
+	}
+	return false
+}
+
+//go:embed dict/*.txt
+var dictFS embed.FS
+
+// dict is one OpenCC dictionary: key → replacement, matched longest first.
+type dict struct {
+	m      map[string]string
+	maxLen int // longest key in runes
+}
+
+var (
+	loadOnce sync.Once
+	dicts    map[string]*dict
+)
+
+func load() {
+	dicts = map[string]*dict{}
+	for _, name := range []string{
+		"STCharacters", "STPhrases", "STPhrasesExtra", "TSCharacters", "TSPhrases", "TWPhrases", "TWVariants", "HKVariants",
+	} {
+		data, err := dictFS.ReadFile("dict/" + name + ".txt")
+		if err != nil {
+			panic(err) // embedded, cannot fail
+		}
+		d := &dict{m: map[string]string{}}
+		sc := bufio.NewScanner(bytes.NewReader(data))
+		for sc.Scan() {
+			k, v, ok := strings.Cut(sc.Text(), "\t")
+			if !ok || k == "" {
+				continue
+			}
+			// OpenCC lists alternatives separated by spaces; the first is the default
+			v, _, _ = strings.Cut(v, " ")
+			d.m[k] = v
+			d.maxLen = max(d.maxLen, utf8.RuneCountInString(k))
+		}
+		dicts[name] = d
+	}
+}
+
+// chains lists the dictionary groups applied in order for each conversion.
+// Dictionaries within a group are matched together, longest key first; on
+// keys of equal length the earlier dictionary wins, so STPhrasesExtra
+// overrides the generated tables.
+var chains = map[Conversion][][]string{
+	S2T:  {{"STPhrasesExtra", "STPhrases", "STCharacters"}},
+	T2S:  {{"TSPhrases", "TSCharacters"}},
+	S2TW: {{"STPhrasesExtra", "STPhrases", "STCharacters"}, {"TWPhrases"}, {"TWVariants"}},
+	S2HK: {{"STPhrasesExtra", "STPhrases", "STCharacters"}, {"HKVariants"}},
+}
+
+// Convert returns s converted per c. Text that is not Chinese, or already in
+// the target script, is returned unchanged.
+func Convert(s string, c Conversion) string {
+	chain, ok := chains[c]
+	if !ok || s == "" {
+		return s
+	}
+	loadOnce.Do(load)
+	for _, group := range chain {
+		ds := make([]*dict, len(group))
+		for i, name := range group {
+			ds[i] = dicts[name]
+		}
+		s = convertGroup(s, ds)
+	}
+	return s
+}
+
+// convertGroup scans s left to right, replacing the longest key found in any
+// of ds at each position.
+func convertGroup(s string, ds []*dict) string {
+	maxLen := 0
+	for _, d := range ds {
+		maxLen = max(maxLen, d.maxLen)
+	}
+	runes := []rune(s)
+	var sb strings.Builder
+	for i := 0; i < len(runes); {
+		matched := false
+		for n := min(maxLen, len(runes)-i); n > 0 && !matched; n-- {
+			key := string(runes[i : i+n])
+			for _, d := range ds {
+				if v, ok := d.m[key]; ok {
+					sb.WriteString(v)
+					i += n
+					matched = true
+					break
+				}
+			}
+		}
+		if !matched {
+			sb.WriteRune(runes[i])
+			i++
+		}
+	}
+	return sb.String()
+}
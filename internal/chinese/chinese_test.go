@@ -0,0 +1,56 @@
+package chinese
+
+import "testing"
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		in   string
+		c    Conversion
+		want string
+	}{
+		{"简体中文", S2T, "簡體中文"},
+		{"头发", S2T, "頭髮"},
+		{"簡體中文", T2S, "简体中文"},
+		{"软件", S2T, "軟件"},
+		{"软件和网络", S2TW, "軟體和網路"},
+		{"打印机", S2TW, "印表機"},
+		{"打印", S2TW, "列印"},
+		{"温度", S2TW, "溫度"},
+		{"皇后大道东", S2T, "皇后大道東"},
+		{"天后", S2T, "天后"},
+		{"影后", S2T, "影后"},
+		{"王后", S2T, "王后"},
+		{"以后", S2T, "以後"},
+		{"钟楚红", S2T, "鍾楚紅"},
+		{"一见钟情", S2T, "一見鍾情"},
+		{"时钟", S2T, "時鐘"},
+		{"范冰冰", S2T, "范冰冰"},
+		{"模范", S2T, "模範"},
+		{"钟楚红", S2HK, "鍾楚紅"},
+		{"皇后大道东", S2TW, "皇后大道東"},
+		{"软件", S2HK, "軟件"},
+		{"Hello 世界", S2T, "Hello 世界"},
+		{"已經是繁體", S2T, "已經是繁體"},
+		{"简体", None, "简体"},
+		{"简体", "zh-cn", "简体"},
+		{"", S2T, ""},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.c)+"/"+tt.in, func(t *testing.T) {
+			if got := Convert(tt.in, tt.c); got != tt.want {
+				t.Errorf("Convert(%q, %q) = %q, want %q", tt.in, tt.c, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValid(t *testing.T) {
+	for _, c := range []Conversion{None, S2T, T2S, S2TW, S2HK} {
+		if !Valid(c) {
+			t.Errorf("Valid(%q) = false", c)
+		}
+	}
+	if Valid("zh-cn") {
+		t.Error(`Valid("zh-cn") = true`)
+	}
+}
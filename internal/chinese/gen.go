@@ -0,0 +1,137 @@
+//go:build ignore
+
+// gen.go regenerates the character and phrase dictionaries in dict/. It is
+// not run by go generate: the output is checked in, and rebuilding it needs
+// inputs that are not part of this repository.
+//
+// Characters come from ICU's Hans-Hant and Hant-Hans transliterators, so the
+// uconv tool must be on PATH (Debian and Ubuntu ship it in icu-devtools).
+// Phrase candidates come from word lists with one word per line, of which
+// the first space-separated field is used. The current tables were built
+// from the zh dictionaries of github.com/go-ego/gse (data/dict/zh/s_1.txt
+// and t_1.txt); download them next to this file and run
+//
+//	go run gen.go -s s_1.txt -t t_1.txt
+//
+// STPhrasesExtra.txt, TWPhrases.txt, TWVariants.txt and HKVariants.txt are
+// maintained by hand. STPhrasesExtra.txt holds the words the character table
+// gets wrong and the word lists miss: 后 meaning "queen" (皇后, 天后) and the
+// surnames 钟 and 范, which map to 鍾 and 范 rather than 鐘 and 範.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+func main() {
+	sWords := flag.String("s", "", "simplified word list")
+	tWords := flag.String("t", "", "traditional word list")
+	out := flag.String("o", "dict", "output directory")
+	flag.Parse()
+
+	// CJK Unified Ideographs and Extension A
+	var chars []string
+	for r := rune(0x3400); r < 0xA000; r++ {
+		if r < 0x4DC0 || r >= 0x4E00 {
+			chars = append(chars, string(r))
+		}
+	}
+	st := diff(chars, uconv("Hans-Hant", chars), nil)
+	ts := diff(chars, uconv("Hant-Hans", chars), nil)
+	write(filepath.Join(*out, "STCharacters.txt"), st)
+	write(filepath.Join(*out, "TSCharacters.txt"), ts)
+
+	if *sWords != "" {
+		words := readWords(*sWords)
+		write(filepath.Join(*out, "STPhrases.txt"), diff(words, uconv("Hans-Hant", words), st))
+	}
+	if *tWords != "" {
+		words := readWords(*tWords)
+		write(filepath.Join(*out, "TSPhrases.txt"), diff(words, uconv("Hant-Hans", words), ts))
+	}
+}
+
+// uconv runs one ICU transliterator over lines.
+func uconv(id string, lines []string) []string {
+	cmd := exec.Command("uconv", "-x", id)
+	cmd.Stdin = strings.NewReader(strings.Join(lines, "\n") + "\n")
+	data, err := cmd.Output()
+	if err != nil {
+		log.Fatalf("uconv %s: %v", id, err)
+	}
+	got := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(got) != len(lines) {
+		log.Fatalf("uconv %s: %d lines in, %d out", id, len(lines), len(got))
+	}
+	return got
+}
+
+// diff returns the entries that convert differently from applying chars
+// one character at a time (all entries when chars is nil).
+func diff(from, to []string, chars map[string]string) map[string]string {
+	m := map[string]string{}
+	for i, f := range from {
+		t := to[i]
+		if f == t || utf8.RuneCountInString(f) != utf8.RuneCountInString(t) {
+			continue
+		}
+		if chars != nil {
+			var naive strings.Builder
+			for _, r := range f {
+				if c, ok := chars[string(r)]; ok {
+					naive.WriteString(c)
+				} else {
+					naive.WriteRune(r)
+				}
+			}
+			if naive.String() == t {
+				continue
+			}
+		}
+		m[f] = t
+	}
+	return m
+}
+
+// readWords returns the multi-character, all-ideograph words in path.
+func readWords(path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var words []string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		w, _, _ := strings.Cut(sc.Text(), " ")
+		if utf8.RuneCountInString(w) < 2 || strings.IndexFunc(w, func(r rune) bool { return r < 0x3400 }) >= 0 {
+			continue
+		}
+		words = append(words, w)
+	}
+	return words
+}
+
+func write(path string, m map[string]string) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b bytes.Buffer
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s\t%s\n", k, m[k])
+	}
+	if err := os.WriteFile(path, b.Bytes(), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,71 @@
+package config
+
+import "testing"
+
+func TestNormalizeNetwork(t *testing.T) {
+	tests := []struct {
+		name string
+		in   NetworkConfig
+		want NetworkConfig
+	}{
+		{
+			name: "zero value",
+			in:   NetworkConfig{},
+			// Zero retries is a valid choice, so it is kept
+			want: NetworkConfig{ProxyMode: ProxySystem, TimeoutSeconds: DefaultNetworkTimeout, MaxConcurrent: DefaultNetworkMaxConcurrent},
+		},
+		{
+			name: "kept",
+			in:   NetworkConfig{ProxyMode: ProxyCustom, ProxyURL: "socks5://h:1", TimeoutSeconds: 3, Retries: 1, MaxConcurrent: 8, UserAgent: "x"},
+			want: NetworkConfig{ProxyMode: ProxyCustom, ProxyURL: "socks5://h:1", TimeoutSeconds: 3, Retries: 1, MaxConcurrent: 8, UserAgent: "x"},
+		},
+		{
+			name: "out of range",
+			in:   NetworkConfig{ProxyMode: "pac", TimeoutSeconds: -1, Retries: 99, MaxConcurrent: -2},
+			want: NetworkConfig{ProxyMode: ProxySystem, TimeoutSeconds: DefaultNetworkTimeout, Retries: maxNetworkRetries, MaxConcurrent: DefaultNetworkMaxConcurrent},
+		},
+		{
+			name: "negative retries",
+			in:   NetworkConfig{ProxyMode: ProxyNone, TimeoutSeconds: 5, Retries: -1, MaxConcurrent: 1},
+			want: NetworkConfig{ProxyMode: ProxyNone, TimeoutSeconds: 5, Retries: 0, MaxConcurrent: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeNetwork(tt.in); got != tt.want {
+				t.Errorf("normalizeNetwork = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeMusicBrainz(t *testing.T) {
+	tests := []struct {
+		name string
+		in   MusicBrainzConfig
+		want MusicBrainzConfig
+	}{
+		{
+			name: "defaults filled",
+			in:   MusicBrainzConfig{Enabled: true},
+			want: MusicBrainzConfig{Enabled: true, BaseURL: DefaultMusicBrainzURL, RateLimitMs: DefaultMusicBrainzRateLimit, MinScore: DefaultMusicBrainzMinScore},
+		},
+		{
+			name: "kept",
+			in:   MusicBrainzConfig{BaseURL: "http://mb.local/ws/2", RateLimitMs: 200, MinScore: 75},
+			want: MusicBrainzConfig{BaseURL: "http://mb.local/ws/2", RateLimitMs: 200, MinScore: 75},
+		},
+		{
+			name: "out of range score",
+			in:   MusicBrainzConfig{BaseURL: "http://mb.local/ws/2", RateLimitMs: -5, MinScore: 150},
+			want: MusicBrainzConfig{BaseURL: "http://mb.local/ws/2", RateLimitMs: DefaultMusicBrainzRateLimit, MinScore: DefaultMusicBrainzMinScore},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeMusicBrainz(tt.in); got != tt.want {
+				t.Errorf("normalizeMusicBrainz = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
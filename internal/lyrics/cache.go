@@ -0,0 +1,180 @@
+package lyrics
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Layout values control how translations are merged into the LRC output.
+const (
+	// LayoutOriginal writes the original lyrics only.
+	LayoutOriginal = "original"
+	// LayoutInterleaved writes the translation as its own line directly after
+	// the original line, both carrying the same timestamp. Most players show
+	// the pair stacked.
+	LayoutInterleaved = "interleaved"
+	// LayoutSameLine appends the translation to the original line
+	// ("original / translation"), for players that show one line per timestamp.
+	LayoutSameLine = "sameLine"
+)
+
+// sameLineSeparator joins original and translation in LayoutSameLine.
+const sameLineSeparator = " / "
+
+// ErrNotCached is returned when the cache has no lyrics for a song.
+var ErrNotCached = errors.New("lyrics not found in cache")
+
+// CachedLyrics is the lyric data the NetEase client caches per song.
+type CachedLyrics struct {
+	Lyric       string // original LRC
+	Translation string // tlyric: translated LRC
+	Romaji      string // romalrc: romanised LRC
+}
+
+// DefaultCacheDir returns the NetEase desktop client's lyric cache directory,
+// or "" when it is not known for this platform.
+func DefaultCacheDir() string {
+	if local := os.Getenv("LOCALAPPDATA"); local != "" {
+		return filepath.Join(local, "NetEase", "CloudMusic", "webdata", "lyric")
+	}
+	return ""
+}
+
+// CachePath returns the path of the cache entry for a song ID.
+// The client stores one extension-less JSON file per song ID.
+func CachePath(dir, songID string) string {
+	return filepath.Join(dir, songID)
+}
+
+// LoadCache reads the cached lyrics for songID from dir. Song IDs are
+// numbers; anything else, which could name a path outside dir, is treated
+// as not cached.
+func LoadCache(dir, songID string) (*CachedLyrics, error) {
+	if dir == "" {
+		return nil, ErrNotCached
+	}
+	if _, err := strconv.ParseUint(songID, 10, 64); err != nil {
+		return nil, ErrNotCached
+	}
+	data, err := os.ReadFile(CachePath(dir, songID))
+	if os.IsNotExist(err) {
+		return nil, ErrNotCached
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ParseCache(data)
+}
+
+// ParseCache decodes a lyric cache entry. Both the flat client format
+// ({"lyric": "...", "tlyric": "..."}) and the API format
+// ({"lrc": {"lyric": "..."}, "tlyric": {"lyric": "..."}}) are accepted.
+func ParseCache(data []byte) (*CachedLyrics, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	c := &CachedLyrics{
+		Lyric:       firstLyric(raw, "lyric", "lrc"),
+		Translation: firstLyric(raw, "tlyric"),
+		Romaji:      firstLyric(raw, "romalrc"),
+	}
+	if strings.TrimSpace(c.Lyric) == "" {
+		return nil, ErrNotCached
+	}
+	return c, nil
+}
+
+// firstLyric returns the first non-empty lyric among keys. Each value may be
+// a plain string or an object with a "lyric" string field.
+func firstLyric(raw map[string]json.RawMessage, keys ...string) string {
+	for _, k := range keys {
+		v, ok := raw[k]
+		if !ok {
+			continue
+		}
+		var s string
+		if json.Unmarshal(v, &s) == nil && s != "" {
+			return s
+		}
+		var obj struct {
+			Lyric string `json:"lyric"`
+		}
+		if json.Unmarshal(v, &obj) == nil && obj.Lyric != "" {
+			return obj.Lyric
+		}
+	}
+	return ""
+}
+
+// MergeOptions controls how cached lyrics are turned into LRC.
+type MergeOptions struct {
+	Layout string // LayoutOriginal, LayoutInterleaved or LayoutSameLine
+	Romaji bool   // also include the romanised lyrics, in the same layout
+}
+
+// Merge builds a single LRC from the cached original, translation and
+// romanisation. Translated lines are matched to original lines by timestamp.
+func (c *CachedLyrics) Merge(opts MergeOptions) *LRC {
+	out := Parse(c.Lyric)
+	if opts.Layout == "" || opts.Layout == LayoutOriginal {
+		return out
+	}
+
+	var extras []map[int64]string
+	if opts.Romaji && c.Romaji != "" {
+		extras = append(extras, indexByTime(Parse(c.Romaji)))
+	}
+	if c.Translation != "" {
+		extras = append(extras, indexByTime(Parse(c.Translation)))
+	}
+	if len(extras) == 0 {
+		return out
+	}
+
+	lines := make([]Line, 0, len(out.Lines)*(1+len(extras)))
+	for _, ln := range out.Lines {
+		key := timeKey(ln.Time)
+		switch opts.Layout {
+		case LayoutSameLine:
+			text := ln.Text
+			for _, ex := range extras {
+				if t := ex[key]; t != "" && ln.Text != "" {
+					text += sameLineSeparator + t
+				}
+			}
+			lines = append(lines, Line{Time: ln.Time, Text: text})
+		default: // LayoutInterleaved
+			lines = append(lines, ln)
+			for _, ex := range extras {
+				if t := ex[key]; t != "" && ln.Text != "" {
+					lines = append(lines, Line{Time: ln.Time, Text: t})
+				}
+			}
+		}
+	}
+	out.Lines = lines
+	return out
+}
+
+// indexByTime maps each non-empty line to its timestamp key.
+func indexByTime(l *LRC) map[int64]string {
+	m := make(map[int64]string, len(l.Lines))
+	for _, ln := range l.Lines {
+		if ln.Text != "" {
+			m[timeKey(ln.Time)] = ln.Text
+		}
+	}
+	return m
+}
+
+// timeKey rounds to centiseconds, the precision of most LRC files, so
+// "[00:12.34]" and "[00:12.340]" match.
+func timeKey(d time.Duration) int64 {
+	return (d.Milliseconds() + 5) / 10
+}
@@ -0,0 +1,89 @@
+package lyrics
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseCache(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    *CachedLyrics
+		wantErr error
+	}{
+		{
+			name: "client format",
+			data: `{"lyric":"[00:01.00]a","tlyric":"[00:01.00]甲","romalrc":"[00:01.00]ei"}`,
+			want: &CachedLyrics{Lyric: "[00:01.00]a", Translation: "[00:01.00]甲", Romaji: "[00:01.00]ei"},
+		},
+		{
+			name: "api format",
+			data: `{"lrc":{"lyric":"[00:01.00]a"},"tlyric":{"lyric":"[00:01.00]甲"},"code":200}`,
+			want: &CachedLyrics{Lyric: "[00:01.00]a", Translation: "[00:01.00]甲"},
+		},
+		{
+			name: "empty lyric falls back to lrc",
+			data: `{"lyric":"","lrc":{"lyric":"[00:01.00]a"}}`,
+			want: &CachedLyrics{Lyric: "[00:01.00]a"},
+		},
+		{name: "no lyrics", data: `{"lyric":"  ","tlyric":"[00:01.00]甲"}`, wantErr: ErrNotCached},
+		{name: "not json", data: `<html>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCache([]byte(tt.data))
+			if tt.want == nil {
+				if err == nil || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+					t.Errorf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseCache = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	c := &CachedLyrics{
+		Lyric:       "[ti:Song]\n[00:01.00]one\n[00:02.00]\n[00:03.00]three",
+		Translation: "[00:01.000]一\n[00:02.00]二\n[00:04.00]四",
+		Romaji:      "[00:01.00]ichi\n[00:03.00]san",
+	}
+	tests := []struct {
+		name string
+		opts MergeOptions
+		want []string
+	}{
+		{"original", MergeOptions{Layout: LayoutOriginal}, []string{"one", "", "three"}},
+		{"default is original", MergeOptions{}, []string{"one", "", "three"}},
+		{"interleaved", MergeOptions{Layout: LayoutInterleaved}, []string{"one", "一", "", "three"}},
+		{"same line", MergeOptions{Layout: LayoutSameLine}, []string{"one / 一", "", "three"}},
+		{"interleaved with romaji", MergeOptions{Layout: LayoutInterleaved, Romaji: true}, []string{"one", "ichi", "一", "", "three", "san"}},
+		{"same line with romaji", MergeOptions{Layout: LayoutSameLine, Romaji: true}, []string{"one / ichi / 一", "", "three / san"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := c.Merge(tt.opts)
+			var got []string
+			for _, ln := range l.Lines {
+				got = append(got, ln.Text)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lines = %q, want %q", got, tt.want)
+			}
+			if l.Title != "Song" {
+				t.Errorf("title = %q", l.Title)
+			}
+		})
+	}
+	if got := (&CachedLyrics{Lyric: "[00:01.00]a"}).Merge(MergeOptions{Layout: LayoutSameLine}); got.Plain() != "a" {
+		t.Errorf("no translation: %q", got.Plain())
+	}
+}
@@ -0,0 +1,55 @@
+package lyrics
+
+import (
+	"bytes"
+	"os"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// Encoding names reported by Decode.
+const (
+	EncodingUTF8    = "UTF-8"
+	EncodingUTF16LE = "UTF-16LE"
+	EncodingUTF16BE = "UTF-16BE"
+	EncodingGBK     = "GBK"
+)
+
+// Decode converts lyric file bytes to a UTF-8 string and reports the detected
+// source encoding. Byte order marks are honoured and stripped; data that is not
+// valid UTF-8 is assumed to be GBK (decoded as its superset GB18030), which is
+// what older Chinese lyric tools write.
+func Decode(data []byte) (string, string) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return string(data[3:]), EncodingUTF8
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return decodeWith(data, unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM).NewDecoder().Bytes), EncodingUTF16LE
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return decodeWith(data, unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM).NewDecoder().Bytes), EncodingUTF16BE
+	case utf8.Valid(data):
+		return string(data), EncodingUTF8
+	}
+	return decodeWith(data, simplifiedchinese.GB18030.NewDecoder().Bytes), EncodingGBK
+}
+
+func decodeWith(data []byte, decode func([]byte) ([]byte, error)) string {
+	out, err := decode(data)
+	if err != nil {
+		return string(bytes.ToValidUTF8(data, []byte("\uFFFD")))
+	}
+	return string(out)
+}
+
+// Load reads a lyric file and returns its text as UTF-8 along with the
+// detected source encoding.
+func Load(path string) (string, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", err
+	}
+	text, enc := Decode(data)
+	return text, enc, nil
+}
@@ -0,0 +1,65 @@
+package lyrics
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func TestDecode(t *testing.T) {
+	const text = "[00:01.00]歌词 lyrics"
+	encode := func(t *testing.T, e interface{ Bytes([]byte) ([]byte, error) }) []byte {
+		t.Helper()
+		b, err := e.Bytes([]byte(text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	tests := []struct {
+		name    string
+		data    func(t *testing.T) []byte
+		want    string
+		wantEnc string
+	}{
+		{"utf-8", func(*testing.T) []byte { return []byte(text) }, text, EncodingUTF8},
+		{"utf-8 with BOM", func(*testing.T) []byte { return append([]byte{0xEF, 0xBB, 0xBF}, text...) }, text, EncodingUTF8},
+		{"utf-16le", func(t *testing.T) []byte {
+			return encode(t, unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewEncoder())
+		}, text, EncodingUTF16LE},
+		{"utf-16be", func(t *testing.T) []byte {
+			return encode(t, unicode.UTF16(unicode.BigEndian, unicode.UseBOM).NewEncoder())
+		}, text, EncodingUTF16BE},
+		{"gbk", func(t *testing.T) []byte { return encode(t, simplifiedchinese.GBK.NewEncoder()) }, text, EncodingGBK},
+		{"empty", func(*testing.T) []byte { return nil }, "", EncodingUTF8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, enc := Decode(tt.data(t))
+			if got != tt.want || enc != tt.wantEnc {
+				t.Errorf("Decode = %q, %s; want %q, %s", got, enc, tt.want, tt.wantEnc)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "song.lrc")
+	gbk, err := simplifiedchinese.GBK.NewEncoder().Bytes([]byte("[00:01.00]歌词"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, gbk, 0644); err != nil {
+		t.Fatal(err)
+	}
+	text, enc, err := Load(path)
+	if err != nil || text != "[00:01.00]歌词" || enc != EncodingGBK {
+		t.Errorf("Load = %q, %s, %v", text, enc, err)
+	}
+	if _, _, err := Load(filepath.Join(t.TempDir(), "missing.lrc")); err == nil {
+		t.Error("missing file loaded")
+	}
+}
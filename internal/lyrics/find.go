@@ -0,0 +1,117 @@
+package lyrics
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// FindOptions describes the song whose .lrc file should be located.
+type FindOptions struct {
+	Source    string   // path of the .ncm being converted
+	Title     string   // Meta.MusicName
+	Artists   []string // individual artist names
+	ExtraDirs []string // additional directories to search, in order
+}
+
+// Find returns the path of the best matching .lrc file, or "" when none exists.
+//
+// The lookup order is:
+//  1. a file next to the source with the same base name (extensions match case-insensitively);
+//  2. in the source directory, a file named after the song, e.g. "Artist - Title.lrc",
+//     "Title - Artist.lrc" or "Title.lrc";
+//  3. in each of ExtraDirs, a file naming the artist as well as the title. Shared
+//     lyric folders often hold several songs called "Intro", so "Title.lrc" is not
+//     enough there.
+//
+// Names are compared after folding case and dropping punctuation and spaces,
+// so "A,B - Song.LRC" matches the artists ["A", "B"] and the title "Song".
+func Find(opts FindOptions) string {
+	srcDir := filepath.Dir(opts.Source)
+	srcBase := strings.TrimSuffix(filepath.Base(opts.Source), filepath.Ext(opts.Source))
+
+	dirs := append([]string{srcDir}, opts.ExtraDirs...)
+	listings := make([]map[string]string, len(dirs))
+	for i, d := range dirs {
+		listings[i] = listLrc(d)
+	}
+
+	if p, ok := listings[0][normalize(srcBase)]; ok {
+		return p
+	}
+
+	candidates := nameCandidates(opts.Title, opts.Artists)
+	for i, files := range listings {
+		names := candidates
+		if title := normalize(opts.Title); i == 0 && title != "" {
+			names = append(names[:len(names):len(names)], title)
+		}
+		for _, c := range names {
+			if p, ok := files[c]; ok {
+				return p
+			}
+		}
+	}
+	return ""
+}
+
+// nameCandidates returns the normalised base names, naming the artists too,
+// that a lyric file for the song may use.
+func nameCandidates(title string, artists []string) []string {
+	if normalize(title) == "" {
+		return nil
+	}
+	var out []string
+	add := func(s string) {
+		if n := normalize(s); n != "" {
+			out = append(out, n)
+		}
+	}
+	all := strings.Join(artists, ",")
+	if all != "" {
+		add(all + " - " + title)
+		add(title + " - " + all)
+	}
+	if len(artists) > 1 {
+		add(artists[0] + " - " + title)
+		add(title + " - " + artists[0])
+	}
+	return out
+}
+
+// listLrc maps the normalised base name of every .lrc file in dir to its path.
+// Unreadable or missing directories yield an empty map.
+func listLrc(dir string) map[string]string {
+	files := map[string]string{}
+	if dir == "" {
+		return files
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return files
+	}
+	for _, e := range entries {
+		name := e.Name()
+		ext := filepath.Ext(name)
+		if e.IsDir() || !strings.EqualFold(ext, ".lrc") {
+			continue
+		}
+		key := normalize(strings.TrimSuffix(name, ext))
+		if _, dup := files[key]; !dup {
+			files[key] = filepath.Join(dir, name)
+		}
+	}
+	return files
+}
+
+// normalize folds case and keeps only letters and digits.
+func normalize(s string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
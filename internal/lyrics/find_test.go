@@ -0,0 +1,93 @@
+package lyrics
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFiles creates empty files under dir.
+func writeFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range names {
+		if err := os.WriteFile(filepath.Join(dir, n), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     []string // files next to the source
+		extra   []string // files in the search dir
+		title   string
+		artists []string
+		want    string // "src/…", "extra/…" or ""
+	}{
+		{"same base name", []string{"track.LRC", "Song.lrc"}, nil, "Song", []string{"A"}, "src/track.LRC"},
+		{"artist - title", []string{"A - Song.lrc"}, nil, "Song", []string{"A"}, "src/A - Song.lrc"},
+		{"title - artists", []string{"song - a, b.lrc"}, nil, "Song", []string{"A", "B"}, "src/song - a, b.lrc"},
+		{"first artist", []string{"A - Song.lrc"}, nil, "Song", []string{"A", "B"}, "src/A - Song.lrc"},
+		{"bare title next to the source", []string{"Song.lrc"}, nil, "Song", []string{"A"}, "src/Song.lrc"},
+		{"source dir first", []string{"Song.lrc"}, []string{"A - Song.lrc"}, "Song", []string{"A"}, "src/Song.lrc"},
+		{"artist in search dir", nil, []string{"A - Intro.lrc", "Intro.lrc"}, "Intro", []string{"A"}, "extra/A - Intro.lrc"},
+		{"bare title in search dir ignored", nil, []string{"Intro.lrc"}, "Intro", []string{"A"}, ""},
+		{"other artist in search dir ignored", nil, []string{"B - Intro.lrc"}, "Intro", []string{"A"}, ""},
+		{"no title", []string{"A.lrc"}, nil, "", []string{"A"}, ""},
+		{"not an lrc", []string{"Song.txt"}, nil, "Song", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			src, extra := filepath.Join(root, "src"), filepath.Join(root, "extra")
+			writeFiles(t, src, append(tt.src, "track.ncm")...)
+			writeFiles(t, extra, tt.extra...)
+			got := Find(FindOptions{
+				Source:    filepath.Join(src, "track.ncm"),
+				Title:     tt.title,
+				Artists:   tt.artists,
+				ExtraDirs: []string{extra, filepath.Join(root, "missing")},
+			})
+			want := ""
+			if tt.want != "" {
+				want = filepath.Join(root, filepath.FromSlash(tt.want))
+			}
+			if got != want {
+				t.Errorf("Find = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestLoadCache(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "cache")
+	writeFiles(t, root, "secret")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "42"), []byte(`{"lyric":"[00:01.00]la","tlyric":"[00:01.00]啦"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := LoadCache(dir, "42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Lyric != "[00:01.00]la" || c.Translation != "[00:01.00]啦" {
+		t.Errorf("LoadCache = %+v", c)
+	}
+	for _, id := range []string{"", "7", "../secret", "42/..", "-1", "4 2"} {
+		if _, err := LoadCache(dir, id); !errors.Is(err, ErrNotCached) {
+			t.Errorf("LoadCache(%q) error = %v, want ErrNotCached", id, err)
+		}
+	}
+	if _, err := LoadCache("", "42"); !errors.Is(err, ErrNotCached) {
+		t.Errorf("no cache dir: %v", err)
+	}
+}
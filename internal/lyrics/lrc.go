@@ -0,0 +1,177 @@
+// Package lyrics parses, converts and formats LRC lyrics.
+package lyrics
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Line is a single timed lyric line.
+type Line struct {
+	Time time.Duration
+	Text string
+}
+
+// LRC holds parsed LRC lyrics. Line times already have Offset applied.
+type LRC struct {
+	Title  string // [ti:]
+	Artist string // [ar:]
+	Album  string // [al:]
+	By     string // [by:]
+	Offset time.Duration
+	Lines  []Line // sorted by Time
+	// Untimed holds text lines that carry no timestamp (plain-text lyrics).
+	Untimed []string
+}
+
+var (
+	// [mm:ss], [mm:ss.xx], [mm:ss.xxx] and the non-standard [mm:ss:xx]
+	timeTagRe = regexp.MustCompile(`^\[(\d+):(\d{1,2})(?:[.:](\d{1,3}))?\]`)
+	// [key:value] header tags such as [ti:Title]
+	headerTagRe = regexp.MustCompile(`^\[([a-zA-Z#]+):(.*)\]$`)
+)
+
+// Parse parses LRC text. Lines with several timestamps
+// ("[00:12.00][01:40.00]chorus") produce one Line per timestamp.
+// Malformed lines are kept as untimed text rather than rejected.
+func Parse(text string) *LRC {
+	l := &LRC{}
+	text = strings.TrimPrefix(text, "\ufeff")
+	for _, raw := range strings.Split(text, "\n") {
+		line := strings.TrimSpace(strings.TrimSuffix(raw, "\r"))
+		if line == "" {
+			continue
+		}
+
+		var times []time.Duration
+		for {
+			m := timeTagRe.FindStringSubmatch(line)
+			if m == nil {
+				break
+			}
+			times = append(times, parseTimeTag(m[1], m[2], m[3]))
+			line = line[len(m[0]):]
+		}
+		if len(times) > 0 {
+			text := strings.TrimSpace(line)
+			for _, t := range times {
+				l.Lines = append(l.Lines, Line{Time: t, Text: text})
+			}
+			continue
+		}
+
+		if m := headerTagRe.FindStringSubmatch(line); m != nil {
+			l.setHeader(strings.ToLower(m[1]), strings.TrimSpace(m[2]))
+			continue
+		}
+		l.Untimed = append(l.Untimed, line)
+	}
+
+	// A positive offset makes lyrics appear earlier
+	if l.Offset != 0 {
+		for i := range l.Lines {
+			t := l.Lines[i].Time - l.Offset
+			if t < 0 {
+				t = 0
+			}
+			l.Lines[i].Time = t
+		}
+	}
+	sort.SliceStable(l.Lines, func(i, j int) bool { return l.Lines[i].Time < l.Lines[j].Time })
+	return l
+}
+
+func (l *LRC) setHeader(key, value string) {
+	switch key {
+	case "ti":
+		l.Title = value
+	case "ar":
+		l.Artist = value
+	case "al":
+		l.Album = value
+	case "by":
+		l.By = value
+	case "offset":
+		if ms, err := strconv.Atoi(strings.TrimPrefix(value, "+")); err == nil {
+			l.Offset = time.Duration(ms) * time.Millisecond
+		}
+	}
+}
+
+// parseTimeTag converts the captured mm, ss and fraction groups to a duration.
+// The fraction is interpreted by its width: "5" = 500ms, "50" = 500ms, "500" = 500ms.
+func parseTimeTag(mm, ss, frac string) time.Duration {
+	m, _ := strconv.Atoi(mm)
+	s, _ := strconv.Atoi(ss)
+	d := time.Duration(m)*time.Minute + time.Duration(s)*time.Second
+	if frac != "" {
+		f, _ := strconv.Atoi(frac)
+		for i := len(frac); i < 3; i++ {
+			f *= 10
+		}
+		d += time.Duration(f) * time.Millisecond
+	}
+	return d
+}
+
+// IsEmpty reports whether the lyrics contain no text at all.
+func (l *LRC) IsEmpty() bool {
+	return l == nil || (len(l.Lines) == 0 && len(l.Untimed) == 0)
+}
+
+// Synced reports whether the lyrics carry timestamps.
+func (l *LRC) Synced() bool {
+	return l != nil && len(l.Lines) > 0
+}
+
+// Plain returns the lyrics as unsynchronised text, one line per row.
+// Consecutive duplicate lines produced by multi-timestamp tags are kept,
+// since they reflect repeated passages in the song.
+func (l *LRC) Plain() string {
+	if l == nil {
+		return ""
+	}
+	rows := make([]string, 0, len(l.Lines)+len(l.Untimed))
+	for _, ln := range l.Lines {
+		rows = append(rows, ln.Text)
+	}
+	rows = append(rows, l.Untimed...)
+	return strings.Join(rows, "\n")
+}
+
+// String formats the lyrics back to LRC text. Offset is not written
+// because it has already been applied to the line times.
+func (l *LRC) String() string {
+	if l == nil {
+		return ""
+	}
+	var sb strings.Builder
+	for _, h := range [][2]string{{"ti", l.Title}, {"ar", l.Artist}, {"al", l.Album}, {"by", l.By}} {
+		if h[1] != "" {
+			fmt.Fprintf(&sb, "[%s:%s]\n", h[0], h[1])
+		}
+	}
+	for _, ln := range l.Lines {
+		sb.WriteString(FormatTime(ln.Time))
+		sb.WriteString(ln.Text)
+		sb.WriteByte('\n')
+	}
+	for _, u := range l.Untimed {
+		sb.WriteString(u)
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// FormatTime formats d as an LRC time tag, e.g. "[01:02.34]".
+func FormatTime(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	cs := d.Milliseconds() / 10
+	return fmt.Sprintf("[%02d:%02d.%02d]", cs/6000, cs/100%60, cs%100)
+}
@@ -0,0 +1,103 @@
+package lyrics
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func ms(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name        string
+		text        string
+		wantLines   []Line
+		wantUntimed []string
+		wantTitle   string
+	}{
+		{
+			name:      "fractions of every width",
+			text:      "[00:01.5]a\n[00:02.50]b\n[00:03.500]c\n[01:04]d\n[00:05:25]e",
+			wantLines: []Line{{ms(1500), "a"}, {ms(2500), "b"}, {ms(3500), "c"}, {ms(5250), "e"}, {ms(64000), "d"}},
+		},
+		{
+			name:      "several timestamps, sorted",
+			text:      "[00:12.00][00:02.00]chorus\n[00:05.00]verse",
+			wantLines: []Line{{ms(2000), "chorus"}, {ms(5000), "verse"}, {ms(12000), "chorus"}},
+		},
+		{
+			name:      "headers, BOM and CRLF",
+			text:      "\ufeff[ti: Song ]\r\n[ar:Band]\r\n[00:01.00]la\r\n",
+			wantLines: []Line{{ms(1000), "la"}},
+			wantTitle: "Song",
+		},
+		{
+			name:      "positive offset shows lyrics earlier",
+			text:      "[offset:+500]\n[00:01.00]a\n[00:00.20]b",
+			wantLines: []Line{{0, "b"}, {ms(500), "a"}},
+		},
+		{
+			name:      "negative offset",
+			text:      "[offset:-250]\n[00:01.00]a",
+			wantLines: []Line{{ms(1250), "a"}},
+		},
+		{
+			name:        "plain text and malformed tags",
+			text:        "first\n[00:xx]second\n\n[00:01.00]",
+			wantLines:   []Line{{ms(1000), ""}},
+			wantUntimed: []string{"first", "[00:xx]second"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := Parse(tt.text)
+			if !reflect.DeepEqual(l.Lines, tt.wantLines) {
+				t.Errorf("lines = %v, want %v", l.Lines, tt.wantLines)
+			}
+			if !reflect.DeepEqual(l.Untimed, tt.wantUntimed) {
+				t.Errorf("untimed = %q, want %q", l.Untimed, tt.wantUntimed)
+			}
+			if l.Title != tt.wantTitle {
+				t.Errorf("title = %q, want %q", l.Title, tt.wantTitle)
+			}
+		})
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "[00:00.00]"},
+		{ms(1234), "[00:01.23]"},
+		{ms(62340), "[01:02.34]"},
+		{ms(100 * 60 * 1000), "[100:00.00]"},
+		{-time.Second, "[00:00.00]"},
+	}
+	for _, tt := range tests {
+		if got := FormatTime(tt.d); got != tt.want {
+			t.Errorf("FormatTime(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestLRCString(t *testing.T) {
+	in := "[ti:Song]\n[ar:Band]\n[offset:1000]\n[00:02.00]a\n[00:03.50]b\nplain\n"
+	want := "[ti:Song]\n[ar:Band]\n[00:01.00]a\n[00:02.50]b\nplain\n"
+	l := Parse(in)
+	if got := l.String(); got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+	if got := Parse(want).String(); got != want {
+		t.Errorf("round trip = %q", got)
+	}
+	if got := l.Plain(); got != "a\nb\nplain" {
+		t.Errorf("Plain = %q", got)
+	}
+	var empty *LRC
+	if !empty.IsEmpty() || empty.Synced() || empty.String() != "" || !Parse("[ti:x]").IsEmpty() {
+		t.Error("empty lyrics misreported")
+	}
+}
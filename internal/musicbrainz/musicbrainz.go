@@ -0,0 +1,402 @@
+// Package musicbrainz finds the MusicBrainz recording for a track by title,
+// artists, album and duration through the MusicBrainz web service
+// (https://musicbrainz.org/doc/MusicBrainz_API). Candidates are scored
+// locally so only confident matches are applied.
+package musicbrainz
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// DefaultBaseURL is the public MusicBrainz web service.
+const DefaultBaseURL = "https://musicbrainz.org/ws/2"
+
+// DefaultInterval is the gap between requests required by the public
+// server's rate limit (one request per second).
+const DefaultInterval = time.Second
+
+// DefaultMinScore is the confidence, 0–1, a candidate needs to be applied.
+const DefaultMinScore = 0.9
+
+// DefaultUserAgent identifies the app in the "app/version ( contact )" form
+// MusicBrainz requires of every client.
+const DefaultUserAgent = "PureNCM/0.0.1 ( mystery0dyl520@gmail.com )"
+
+// minReleaseSimilarity is how closely a release title must match
+// Query.Album for the release to be part of the match.
+const minReleaseSimilarity = 0.8
+
+// searchLimit is the number of candidates requested per search.
+const searchLimit = 10
+
+// maxResponseBytes caps a search response.
+const maxResponseBytes = 4 << 20
+
+// maxRetryAfter caps how long a server's Retry-After header can stall a
+// lookup.
+const maxRetryAfter = 30 * time.Second
+
+// ErrNoMatch is returned when no candidate reaches the minimum score.
+var ErrNoMatch = errors.New("no confident MusicBrainz match")
+
+// Client searches one MusicBrainz server. It is safe for concurrent use;
+// requests are spaced by Interval across all goroutines, and across all
+// clients sharing a Limiter.
+type Client struct {
+	BaseURL  string        // "" = DefaultBaseURL
+	HTTP     *http.Client  // nil = http.DefaultClient
+	Interval time.Duration // minimum gap between requests; 0 = DefaultInterval
+	MinScore float64       // 0 = DefaultMinScore
+	// UserAgent replaces DefaultUserAgent; MusicBrainz blocks generic ones.
+	UserAgent string
+	// Limiter paces the requests; nil = one of the client's own. Clients
+	// created with different settings share one to keep to a single rate.
+	Limiter *Limiter
+	// Retries is the number of extra attempts after a 429 or 503. Each
+	// waits for the next slot, and at least as long as the server asked.
+	Retries int
+
+	own Limiter
+}
+
+// Limiter spaces requests to a server. The zero value is ready to use.
+type Limiter struct {
+	mu   sync.Mutex
+	next time.Time // earliest time the next request may start
+}
+
+// Query describes the track to look up. Empty fields are ignored.
+type Query struct {
+	Title    string
+	Artists  []string
+	Album    string
+	Duration time.Duration
+}
+
+// Match is a recording chosen for a query.
+type Match struct {
+	RecordingID    string
+	ReleaseID      string // the release closely matching Query.Album; "" = none
+	ReleaseGroupID string
+	ArtistIDs      []string
+	// Canonical spellings from MusicBrainz
+	Title   string
+	Artists []string
+	Album   string  // "" when ReleaseID is
+	Score   float64 // 0–1
+}
+
+// Lookup searches for q and returns the best candidate, or ErrNoMatch when
+// none scores at least MinScore.
+func (c *Client) Lookup(ctx context.Context, q Query) (*Match, error) {
+	if strings.TrimSpace(q.Title) == "" {
+		return nil, errors.New("musicbrainz: query has no title")
+	}
+	var res searchResponse
+	if err := c.get(ctx, "/recording", url.Values{
+		"query": {luceneQuery(q)},
+		"limit": {fmt.Sprint(searchLimit)},
+		"fmt":   {"json"},
+	}, &res); err != nil {
+		return nil, err
+	}
+
+	minScore := c.MinScore
+	if minScore <= 0 {
+		minScore = DefaultMinScore
+	}
+	var best *Match
+	for _, rec := range res.Recordings {
+		m := score(q, rec)
+		if best == nil || m.Score > best.Score {
+			best = m
+		}
+	}
+	if best == nil || best.Score < minScore {
+		return nil, ErrNoMatch
+	}
+	return best, nil
+}
+
+// get waits for the rate limit, requests path and decodes the JSON into v,
+// retrying while the server is busy.
+func (c *Client) get(ctx context.Context, path string, query url.Values, v any) error {
+	for attempt := 0; ; attempt++ {
+		if err := c.wait(ctx); err != nil {
+			return err
+		}
+		resp, err := c.do(ctx, path, query)
+		if err != nil {
+			return err
+		}
+		busy := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable
+		if busy && attempt < c.Retries {
+			c.limiter().hold(retryAfter(resp))
+			resp.Body.Close()
+			continue
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("musicbrainz: %s", resp.Status)
+		}
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(data, v)
+	}
+}
+
+// do sends one request for path.
+func (c *Client) do(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	base := c.BaseURL
+	if base == "" {
+		base = DefaultBaseURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(base, "/")+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	ua := c.UserAgent
+	if ua == "" {
+		ua = DefaultUserAgent
+	}
+	req.Header.Set("User-Agent", ua)
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+// retryAfter returns the wait a busy server asked for, 0 if none.
+func retryAfter(resp *http.Response) time.Duration {
+	secs, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || secs < 0 {
+		return 0
+	}
+	return min(time.Duration(secs)*time.Second, maxRetryAfter)
+}
+
+// wait blocks until the next request slot.
+func (c *Client) wait(ctx context.Context) error {
+	interval := c.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return c.limiter().Wait(ctx, interval)
+}
+
+// limiter returns the Limiter pacing c.
+func (c *Client) limiter() *Limiter {
+	if c.Limiter != nil {
+		return c.Limiter
+	}
+	return &c.own
+}
+
+// Wait blocks until the next request slot and holds the one after it
+// interval away. It returns ctx's error if ctx is cancelled first.
+func (l *Limiter) Wait(ctx context.Context, interval time.Duration) error {
+	l.mu.Lock()
+	now := time.Now()
+	start := now
+	if l.next.After(now) {
+		start = l.next
+	}
+	l.next = start.Add(interval)
+	l.mu.Unlock()
+
+	if d := start.Sub(now); d > 0 {
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// hold keeps the next slot at least d away, as asked by a busy server.
+func (l *Limiter) hold(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if t := time.Now().Add(d); t.After(l.next) {
+		l.next = t
+	}
+}
+
+// luceneQuery builds the search. Title and the first artist are required
+// terms; the album only boosts releases that match it.
+func luceneQuery(q Query) string {
+	terms := []string{`recording:"` + escape(q.Title) + `"`}
+	if len(q.Artists) > 0 {
+		terms = append(terms, `AND artist:"`+escape(q.Artists[0])+`"`)
+	}
+	if q.Album != "" {
+		terms = append(terms, `release:"`+escape(q.Album)+`"`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// escape quotes s for use inside a Lucene phrase.
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+// Response shapes, limited to the fields used.
+type (
+	searchResponse struct {
+		Recordings []recording `json:"recordings"`
+	}
+	recording struct {
+		ID           string         `json:"id"`
+		Title        string         `json:"title"`
+		Length       int64          `json:"length"` // milliseconds; 0 = unknown
+		ArtistCredit []artistCredit `json:"artist-credit"`
+		Releases     []release      `json:"releases"`
+	}
+	artistCredit struct {
+		Name   string `json:"name"`
+		Artist struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"artist"`
+	}
+	release struct {
+		ID           string `json:"id"`
+		Title        string `json:"title"`
+		ReleaseGroup struct {
+			ID string `json:"id"`
+		} `json:"release-group"`
+	}
+)
+
+// Score weights. Components that cannot be compared (no album in the query,
+// no length on the recording) are left out and the rest renormalised.
+const (
+	weightTitle    = 0.5
+	weightArtist   = 0.3
+	weightAlbum    = 0.1
+	weightDuration = 0.1
+)
+
+// score rates how well rec matches q and picks the release matching q.Album.
+func score(q Query, rec recording) *Match {
+	m := &Match{RecordingID: rec.ID, Title: rec.Title}
+	for _, ac := range rec.ArtistCredit {
+		m.ArtistIDs = append(m.ArtistIDs, ac.Artist.ID)
+		m.Artists = append(m.Artists, ac.Artist.Name)
+	}
+
+	total, weights := weightTitle*similarity(q.Title, rec.Title), weightTitle
+	if len(q.Artists) > 0 {
+		total += weightArtist * artistOverlap(q.Artists, rec.ArtistCredit)
+		weights += weightArtist
+	}
+
+	if q.Album != "" && len(rec.Releases) > 0 {
+		best, bestAlbum := 0, -1.0
+		for i, r := range rec.Releases {
+			if s := similarity(q.Album, r.Title); s > bestAlbum {
+				best, bestAlbum = i, s
+			}
+		}
+		total += weightAlbum * bestAlbum
+		weights += weightAlbum
+		// A recording appears on many releases; only name one that matches
+		if r := rec.Releases[best]; bestAlbum >= minReleaseSimilarity {
+			m.ReleaseID, m.ReleaseGroupID, m.Album = r.ID, r.ReleaseGroup.ID, r.Title
+		}
+	}
+
+	if q.Duration > 0 && rec.Length > 0 {
+		total += weightDuration * durationScore(q.Duration, time.Duration(rec.Length)*time.Millisecond)
+		weights += weightDuration
+	}
+	m.Score = total / weights
+	return m
+}
+
+// artistOverlap is the share of the query's artists credited on the
+// recording, by best name similarity.
+func artistOverlap(names []string, credits []artistCredit) float64 {
+	var sum float64
+	for _, n := range names {
+		best := 0.0
+		for _, ac := range credits {
+			best = max(best, similarity(n, ac.Name), similarity(n, ac.Artist.Name))
+		}
+		sum += best
+	}
+	return sum / float64(len(names))
+}
+
+// durationScore is 1 within 3 seconds, falling to 0 at 15 seconds apart.
+func durationScore(a, b time.Duration) float64 {
+	d := (a - b).Abs()
+	switch {
+	case d <= 3*time.Second:
+		return 1
+	case d >= 15*time.Second:
+		return 0
+	}
+	return 1 - float64(d-3*time.Second)/float64(12*time.Second)
+}
+
+// similarity compares two names ignoring case, punctuation and spacing:
+// 1 for equal, otherwise the normalised edit distance ratio.
+func similarity(a, b string) float64 {
+	ra, rb := normalize(a), normalize(b)
+	if len(ra) == 0 || len(rb) == 0 {
+		if len(ra) == len(rb) {
+			return 1
+		}
+		return 0
+	}
+	d := levenshtein(ra, rb)
+	return 1 - float64(d)/float64(max(len(ra), len(rb)))
+}
+
+// normalize keeps the lower-cased letters and digits of s.
+func normalize(s string) []rune {
+	var out []rune
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
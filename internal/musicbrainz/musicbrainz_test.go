@@ -0,0 +1,287 @@
+package musicbrainz
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func rec(title string, length int64, artists []string, releases ...string) recording {
+	r := recording{ID: "rec-" + title, Title: title, Length: length}
+	for _, a := range artists {
+		ac := artistCredit{Name: a}
+		ac.Artist.ID, ac.Artist.Name = "art-"+a, a
+		r.ArtistCredit = append(r.ArtistCredit, ac)
+	}
+	for _, t := range releases {
+		rel := release{ID: "rel-" + t, Title: t}
+		rel.ReleaseGroup.ID = "rg-" + t
+		r.Releases = append(r.Releases, rel)
+	}
+	return r
+}
+
+func TestScore(t *testing.T) {
+	threeMin := 3 * time.Minute
+	tests := []struct {
+		name        string
+		q           Query
+		rec         recording
+		minScore    float64
+		maxScore    float64
+		wantRelease string
+	}{
+		{
+			name:        "exact",
+			q:           Query{Title: "Song", Artists: []string{"Band"}, Album: "Album", Duration: threeMin},
+			rec:         rec("Song", 180000, []string{"Band"}, "Single", "Album"),
+			minScore:    1,
+			maxScore:    1,
+			wantRelease: "rel-Album",
+		},
+		{
+			name:     "case and punctuation ignored",
+			q:        Query{Title: "don't stop", Artists: []string{"the band"}},
+			rec:      rec("Don’t Stop!", 0, []string{"The Band"}),
+			minScore: 1,
+			maxScore: 1,
+		},
+		{
+			name:     "unrelated album names no release",
+			q:        Query{Title: "Song", Artists: []string{"Band"}, Album: "Greatest Hits"},
+			rec:      rec("Song", 0, []string{"Band"}, "Live at Wembley", "Xyz"),
+			minScore: 0.8,
+			maxScore: 0.95,
+		},
+		{
+			name:     "no album in query names no release",
+			q:        Query{Title: "Song", Artists: []string{"Band"}},
+			rec:      rec("Song", 0, []string{"Band"}, "First", "Second"),
+			minScore: 1,
+			maxScore: 1,
+		},
+		{
+			name:        "close album spelling",
+			q:           Query{Title: "Song", Artists: []string{"Band"}, Album: "The Album (Deluxe)"},
+			rec:         rec("Song", 0, []string{"Band"}, "The Album: Deluxe"),
+			minScore:    0.95,
+			maxScore:    1,
+			wantRelease: "rel-The Album: Deluxe",
+		},
+		{
+			name:     "wrong artist",
+			q:        Query{Title: "Song", Artists: []string{"Band"}},
+			rec:      rec("Song", 0, []string{"Orchestra"}),
+			minScore: 0.55,
+			maxScore: 0.75,
+		},
+		{
+			name:     "duration far off",
+			q:        Query{Title: "Song", Artists: []string{"Band"}, Duration: threeMin},
+			rec:      rec("Song", 240000, []string{"Band"}),
+			minScore: 0.85,
+			maxScore: 0.95,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := score(tt.q, tt.rec)
+			if m.Score < tt.minScore || m.Score > tt.maxScore {
+				t.Errorf("score = %.3f, want %.2f–%.2f", m.Score, tt.minScore, tt.maxScore)
+			}
+			if m.ReleaseID != tt.wantRelease {
+				t.Errorf("release = %q, want %q", m.ReleaseID, tt.wantRelease)
+			}
+			if tt.wantRelease == "" && (m.ReleaseGroupID != "" || m.Album != "") {
+				t.Errorf("release group %q, album %q without a release", m.ReleaseGroupID, m.Album)
+			}
+		})
+	}
+}
+
+// searchServer returns body for every search and records request times.
+func searchServer(t *testing.T, body string) (*httptest.Server, func() []time.Time, func() []string) {
+	var (
+		mu     sync.Mutex
+		times  []time.Time
+		agents []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		times = append(times, time.Now())
+		agents = append(agents, r.UserAgent())
+		mu.Unlock()
+		if r.URL.Path != "/ws/2/recording" || r.URL.Query().Get("fmt") != "json" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	get := func() []time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]time.Time(nil), times...)
+	}
+	ua := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), agents...)
+	}
+	return srv, get, ua
+}
+
+const searchBody = `{"recordings":[
+	{"id":"r1","title":"Song","length":180000,
+	 "artist-credit":[{"name":"Band","artist":{"id":"a1","name":"Band"}}],
+	 "releases":[{"id":"x1","title":"Album","release-group":{"id":"g1"}}]},
+	{"id":"r2","title":"Song (Live)","length":300000,
+	 "artist-credit":[{"name":"Band","artist":{"id":"a1","name":"Band"}}]}
+]}`
+
+func TestLookup(t *testing.T) {
+	srv, _, agents := searchServer(t, searchBody)
+	c := &Client{BaseURL: srv.URL + "/ws/2/", HTTP: srv.Client(), Interval: time.Millisecond}
+	m, err := c.Lookup(context.Background(), Query{Title: "Song", Artists: []string{"Band"}, Album: "Album", Duration: 3 * time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.RecordingID != "r1" || m.ReleaseID != "x1" || m.ReleaseGroupID != "g1" || len(m.ArtistIDs) != 1 || m.ArtistIDs[0] != "a1" {
+		t.Errorf("Lookup = %+v", m)
+	}
+	if ua := agents(); len(ua) != 1 || ua[0] != DefaultUserAgent {
+		t.Errorf("User-Agent = %q, want %q", ua, DefaultUserAgent)
+	}
+}
+
+func TestLookupThreshold(t *testing.T) {
+	srv, _, _ := searchServer(t, searchBody)
+	tests := []struct {
+		name     string
+		q        Query
+		minScore float64
+		wantErr  error
+	}{
+		{"confident", Query{Title: "Song", Artists: []string{"Band"}}, 0, nil},
+		{"other title", Query{Title: "Another Tune", Artists: []string{"Band"}}, 0, ErrNoMatch},
+		{"other artist", Query{Title: "Song", Artists: []string{"Someone Else"}}, 0, ErrNoMatch},
+		{"lower bar", Query{Title: "Song", Artists: []string{"Someone Else"}}, 0.5, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{BaseURL: srv.URL + "/ws/2", HTTP: srv.Client(), Interval: time.Millisecond, MinScore: tt.minScore}
+			_, err := c.Lookup(context.Background(), tt.q)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Lookup error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+	c := &Client{BaseURL: srv.URL + "/ws/2", HTTP: srv.Client()}
+	if _, err := c.Lookup(context.Background(), Query{Artists: []string{"Band"}}); err == nil {
+		t.Error("query without a title accepted")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	srv, times, _ := searchServer(t, `{"recordings":[]}`)
+	const interval = 40 * time.Millisecond
+	// Two clients, as two batches would have, pace each other
+	var l Limiter
+	clients := []*Client{
+		{BaseURL: srv.URL + "/ws/2", HTTP: srv.Client(), Interval: interval, Limiter: &l},
+		{BaseURL: srv.URL + "/ws/2", HTTP: srv.Client(), Interval: interval, Limiter: &l, MinScore: 0.5},
+	}
+
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = clients[i%2].Lookup(context.Background(), Query{Title: "Song"})
+		}()
+	}
+	wg.Wait()
+	got := times()
+	if len(got) != 4 {
+		t.Fatalf("%d requests, want 4", len(got))
+	}
+	for i := 1; i < len(got); i++ {
+		// Allow for scheduling between the wait and the server seeing it
+		if gap := got[i].Sub(got[i-1]); gap < interval-10*time.Millisecond {
+			t.Errorf("request %d came %v after the previous one, want ≥ %v", i, gap, interval)
+		}
+	}
+
+	// A cancelled lookup gives up its wait
+	ctx, cancel := context.WithTimeout(context.Background(), interval/4)
+	defer cancel()
+	l.next = time.Now().Add(time.Hour)
+	start := time.Now()
+	if _, err := clients[0].Lookup(ctx, Query{Title: "Song"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("cancelled Lookup error = %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("cancelled Lookup waited %v", d)
+	}
+}
+
+func TestRetryBusy(t *testing.T) {
+	const interval = 30 * time.Millisecond
+	tests := []struct {
+		name       string
+		retries    int
+		busy       int    // busy responses before the search succeeds
+		retryAfter string // Retry-After of the busy responses
+		wantCalls  int
+		wantErr    bool
+		minGap     time.Duration // between consecutive requests
+	}{
+		{"paced like new requests", 2, 2, "", 3, false, interval},
+		{"server's wait respected", 1, 1, "1", 2, false, time.Second},
+		{"gives up", 1, 3, "", 2, true, interval},
+		{"no retries", 0, 1, "", 1, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu    sync.Mutex
+				times []time.Time
+			)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				times = append(times, time.Now())
+				n := len(times)
+				mu.Unlock()
+				if n <= tt.busy {
+					if tt.retryAfter != "" {
+						w.Header().Set("Retry-After", tt.retryAfter)
+					}
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				_, _ = w.Write([]byte(searchBody))
+			}))
+			defer srv.Close()
+
+			c := &Client{BaseURL: srv.URL + "/ws/2", HTTP: srv.Client(), Interval: interval, Retries: tt.retries}
+			_, err := c.Lookup(context.Background(), Query{Title: "Song", Artists: []string{"Band"}})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if len(times) != tt.wantCalls {
+				t.Errorf("%d requests, want %d", len(times), tt.wantCalls)
+			}
+			for i := 1; i < len(times); i++ {
+				if gap := times[i].Sub(times[i-1]); gap < tt.minGap-10*time.Millisecond {
+					t.Errorf("retry %d came %v after the previous request, want ≥ %v", i, gap, tt.minGap)
+				}
+			}
+		})
+	}
+}
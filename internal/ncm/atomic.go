@@ -0,0 +1,171 @@
+package ncm
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// In-progress output is written to "<dir>/.purencm-<random>.part" and renamed
+// into place once complete, so a crash never leaves a truncated file under
+// the real name.
+const (
+	tempPrefix = ".purencm-"
+	tempSuffix = ".part"
+)
+
+// journal records the temp files currently being written, so that files left
+// behind by a crash can be removed on the next start. Persistence is off until
+// InitTempJournal is called.
+var journal = &tempJournal{files: map[string]struct{}{}}
+
+type tempJournal struct {
+	mu    sync.Mutex
+	path  string // journal file; "" = in-memory only
+	files map[string]struct{}
+}
+
+func (j *tempJournal) add(name string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.files[name] = struct{}{}
+	j.flush()
+}
+
+func (j *tempJournal) remove(name string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	delete(j.files, name)
+	j.flush()
+}
+
+// flush persists the journal, one path per line. Caller must hold mu.
+// Errors are ignored: the journal only makes cleanup after a crash better.
+func (j *tempJournal) flush() {
+	if j.path == "" {
+		return
+	}
+	if len(j.files) == 0 {
+		_ = os.Remove(j.path)
+		return
+	}
+	names := make([]string, 0, len(j.files))
+	for n := range j.files {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	_ = os.WriteFile(j.path, []byte(strings.Join(names, "\n")+"\n"), 0644)
+}
+
+// isTempName reports whether name looks like one of our temp files.
+func isTempName(name string) bool {
+	base := filepath.Base(name)
+	return strings.HasPrefix(base, tempPrefix) && strings.HasSuffix(base, tempSuffix)
+}
+
+// InitTempJournal removes temp files left over from a previous session and
+// starts recording new ones in journalPath. Leftovers are taken from the
+// journal itself and from a non-recursive scan of dirs (e.g. the output dir).
+// It returns the number of files removed.
+func InitTempJournal(journalPath string, dirs ...string) (int, error) {
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+
+	var stale []string
+	if data, err := os.ReadFile(journalPath); err == nil {
+		sc := bufio.NewScanner(bytes.NewReader(data))
+		for sc.Scan() {
+			if line := strings.TrimSpace(sc.Text()); line != "" {
+				stale = append(stale, line)
+			}
+		}
+	}
+	for _, d := range dirs {
+		if d == "" {
+			continue
+		}
+		entries, err := os.ReadDir(d)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if !e.IsDir() && isTempName(e.Name()) {
+				stale = append(stale, filepath.Join(d, e.Name()))
+			}
+		}
+	}
+
+	removed := 0
+	seen := map[string]bool{}
+	for _, p := range stale {
+		if seen[p] || !isTempName(p) {
+			continue // never delete anything we did not create
+		}
+		seen[p] = true
+		if _, inUse := journal.files[p]; inUse {
+			continue
+		}
+		if err := os.Remove(p); err == nil {
+			removed++
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(journalPath), 0755); err != nil {
+		return removed, err
+	}
+	journal.path = journalPath
+	journal.flush()
+	if len(journal.files) == 0 {
+		_ = os.Remove(journalPath)
+	}
+	return removed, nil
+}
+
+// writeAtomic creates a temp file next to path, lets write fill it, fsyncs it
+// and renames it over path. The temp file is removed on any error.
+func writeAtomic(path string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), tempPrefix+"*"+tempSuffix)
+	if err != nil {
+		return err
+	}
+	name := tmp.Name()
+	journal.add(name)
+	defer journal.remove(name)
+
+	fail := func(err error) error {
+		tmp.Close()
+		os.Remove(name)
+		return err
+	}
+	if err := write(tmp); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Chmod(0644); err != nil { // CreateTemp uses 0600
+		return fail(err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(name)
+		return err
+	}
+	if err := os.Rename(name, path); err != nil {
+		os.Remove(name)
+		return err
+	}
+	return nil
+}
+
+// WriteFileAtomic writes data to path via a temp file and rename.
+func WriteFileAtomic(path string, data []byte) error {
+	return writeAtomic(path, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
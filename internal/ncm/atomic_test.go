@@ -0,0 +1,184 @@
+package ncm
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// useJournal points the temp journal at a fresh file for one test.
+func useJournal(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "journal", "pending.txt")
+	journal.mu.Lock()
+	old := journal.path
+	journal.mu.Unlock()
+	t.Cleanup(func() {
+		journal.mu.Lock()
+		journal.path = old
+		journal.mu.Unlock()
+	})
+	if _, err := InitTempJournal(path); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// tempFiles lists our temp files in dir.
+func tempFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	for _, e := range entries {
+		if isTempName(e.Name()) {
+			out = append(out, e.Name())
+		}
+	}
+	return out
+}
+
+func TestWriteAtomic(t *testing.T) {
+	errWrite := errors.New("disk full")
+	tests := []struct {
+		name     string
+		existing string // "" = no file yet
+		write    func(w io.Writer) error
+		wantErr  error
+		want     string
+	}{
+		{
+			name:  "new file",
+			write: func(w io.Writer) error { _, err := io.WriteString(w, "new"); return err },
+			want:  "new",
+		},
+		{
+			name:     "replaces existing",
+			existing: "old",
+			write:    func(w io.Writer) error { _, err := io.WriteString(w, "new"); return err },
+			want:     "new",
+		},
+		{
+			name:     "failed write keeps existing",
+			existing: "old",
+			write: func(w io.Writer) error {
+				_, _ = io.WriteString(w, "partial")
+				return errWrite
+			},
+			wantErr: errWrite,
+			want:    "old",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			journalPath := useJournal(t)
+			dir := t.TempDir()
+			path := filepath.Join(dir, "Song.mp3")
+			if tt.existing != "" {
+				if err := os.WriteFile(path, []byte(tt.existing), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := writeAtomic(path, func(w io.Writer) error {
+				// The temp file is journaled while it is written
+				data, _ := os.ReadFile(journalPath)
+				if tmp := strings.TrimSpace(string(data)); !isTempName(tmp) || filepath.Dir(tmp) != dir {
+					t.Errorf("journal during write = %q", data)
+				}
+				return tt.write(w)
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			data, _ := os.ReadFile(path)
+			if string(data) != tt.want {
+				t.Errorf("content = %q, want %q", data, tt.want)
+			}
+			if left := tempFiles(t, dir); len(left) > 0 {
+				t.Errorf("temp files left: %v", left)
+			}
+			if _, err := os.Stat(journalPath); !os.IsNotExist(err) {
+				t.Errorf("journal not removed once empty: %v", err)
+			}
+			if fi, err := os.Stat(path); err == nil && tt.wantErr == nil && runtime.GOOS != "windows" {
+				if perm := fi.Mode().Perm(); perm != 0644 {
+					t.Errorf("mode = %v, want 0644", perm)
+				}
+			}
+		})
+	}
+}
+
+func TestInitTempJournal(t *testing.T) {
+	useJournal(t)
+	root := t.TempDir()
+	out, other := filepath.Join(root, "out"), filepath.Join(root, "other")
+	for _, d := range []string{out, other} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]bool{ // path → expected to be removed
+		filepath.Join(out, ".purencm-1.part"):   true,  // found by the scan
+		filepath.Join(other, ".purencm-2.part"): true,  // listed in the journal
+		filepath.Join(other, ".purencm-3.part"): false, // neither
+		filepath.Join(other, "Song.mp3"):        false, // listed, but not ours
+		filepath.Join(out, "Song.mp3"):          false,
+		filepath.Join(out, ".purencm-4.mp3"):    false,
+	}
+	for p := range files {
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	journalPath := filepath.Join(root, "cfg", "pending.txt")
+	if err := os.MkdirAll(filepath.Dir(journalPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	listed := filepath.Join(other, ".purencm-2.part") + "\n\n" + filepath.Join(other, "Song.mp3") + "\n" +
+		filepath.Join(out, ".purencm-1.part") + "\n"
+	if err := os.WriteFile(journalPath, []byte(listed), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := InitTempJournal(journalPath, out, "", filepath.Join(root, "missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("removed %d files, want 2", n)
+	}
+	for p, removed := range files {
+		if _, err := os.Stat(p); os.IsNotExist(err) != removed {
+			t.Errorf("%s: removed = %v, want %v", filepath.Base(p), os.IsNotExist(err), removed)
+		}
+	}
+	if _, err := os.Stat(journalPath); !os.IsNotExist(err) {
+		t.Errorf("empty journal kept: %v", err)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "queue.json")
+	for _, content := range []string{"first", "second"} {
+		if err := WriteFileAtomic(path, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := os.ReadFile(path); string(data) != content {
+			t.Errorf("content = %q, want %q", data, content)
+		}
+	}
+	if err := WriteFileAtomic(filepath.Join(dir, "missing", "x"), nil); err == nil {
+		t.Error("write into a missing directory succeeded")
+	}
+	if left := tempFiles(t, dir); len(left) > 0 {
+		t.Errorf("temp files left: %v", left)
+	}
+}
@@ -0,0 +1,165 @@
+package ncm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CollisionPolicy decides what happens when the output file already exists.
+type CollisionPolicy string
+
+const (
+	CollisionSkip      CollisionPolicy = "skip"      // keep the existing file, report the track as skipped
+	CollisionOverwrite CollisionPolicy = "overwrite" // replace the existing file
+	CollisionRename    CollisionPolicy = "rename"    // write "name (2).ext", "name (3).ext", ...
+	// CollisionReplaceIfBetter replaces an existing copy of the track (any
+	// audio extension) only when the new one has higher quality: FLAC beats
+	// MP3, and a higher bitrate beats a lower one. Otherwise, or when the
+	// existing copy's quality is unknown, it skips.
+	CollisionReplaceIfBetter CollisionPolicy = "replaceIfBetter"
+)
+
+// ErrSkipped is returned by the writers when the collision policy kept an
+// existing output file instead of writing a new one.
+var ErrSkipped = errors.New("output file already exists")
+
+// audioExts are the extensions an existing copy of a track may have.
+var audioExts = []string{".flac", ".mp3"}
+
+// losslessQuality ranks FLAC above any MP3 bitrate.
+const losslessQuality = 1 << 30
+
+// resolveCollision applies policy to the planned output path. It returns the
+// path to write and any worse copies to delete after a successful write, or
+// ErrSkipped when nothing should be written.
+func resolveCollision(path string, policy CollisionPolicy, newQuality int) (string, []string, error) {
+	switch policy {
+	case CollisionSkip:
+		if exists(path) {
+			return path, nil, ErrSkipped
+		}
+	case CollisionRename:
+		return nextFreePath(path), nil, nil
+	case CollisionReplaceIfBetter:
+		base := strings.TrimSuffix(path, filepath.Ext(path))
+		var worse []string
+		for _, ext := range audioExts {
+			existing := base + ext
+			if !exists(existing) {
+				continue
+			}
+			// A copy whose quality cannot be read is kept rather than
+			// assumed worse
+			if q := fileQuality(existing); q == 0 || q >= newQuality {
+				return existing, nil, ErrSkipped
+			}
+			if !strings.EqualFold(existing, path) {
+				worse = append(worse, existing)
+			}
+		}
+		return path, worse, nil
+	}
+	return path, nil, nil // CollisionOverwrite and unknown values
+}
+
+// nextFreePath returns path, or the first "name (n).ext" that does not exist.
+func nextFreePath(path string) string {
+	if !exists(path) {
+		return path
+	}
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for n := 2; ; n++ {
+		p := fmt.Sprintf("%s (%d)%s", base, n, ext)
+		if !exists(p) {
+			return p
+		}
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// audioQuality ranks decrypted audio: lossless first, then by bitrate (bps).
+func audioQuality(format string, bitrate int, audio []byte) int {
+	if format == "flac" {
+		return losslessQuality
+	}
+	if bitrate > 0 {
+		return bitrate
+	}
+	return probeMp3Bitrate(audio)
+}
+
+// fileQuality ranks an existing audio file the same way as audioQuality.
+func fileQuality(path string) int {
+	if strings.EqualFold(filepath.Ext(path), ".flac") {
+		return losslessQuality
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	// Skip the ID3v2 tag on disk: an embedded cover can make it far larger
+	// than the window read below
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(f, header); err == nil && string(header[:3]) == "ID3" {
+		size := 10 + id3Size(header)
+		if header[5]&0x10 != 0 { // footer present
+			size += 10
+		}
+		if _, err := f.Seek(int64(size), io.SeekStart); err != nil {
+			return 0
+		}
+	} else if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0
+	}
+	head := make([]byte, 64*1024)
+	n, _ := io.ReadFull(f, head)
+	return probeMp3Bitrate(head[:n])
+}
+
+// id3Size returns the tag size stored syncsafe in an ID3v2 header, excluding
+// the header itself.
+func id3Size(header []byte) int {
+	return int(header[6]&0x7f)<<21 | int(header[7]&0x7f)<<14 | int(header[8]&0x7f)<<7 | int(header[9]&0x7f)
+}
+
+// mp3Bitrates maps the 4-bit bitrate index to kbps for MPEG-1 and
+// MPEG-2/2.5 Layer III.
+var mp3Bitrates = [2][16]int{
+	{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+	{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+}
+
+// probeMp3Bitrate returns the bitrate in bps of the first MPEG Layer III frame
+// in data, skipping any leading ID3v2 tag. It returns 0 when none is found.
+func probeMp3Bitrate(data []byte) int {
+	if len(data) >= 10 && string(data[:3]) == "ID3" {
+		data = data[min(len(data), 10+id3Size(data)):]
+	}
+	for i := 0; i+4 <= len(data); i++ {
+		if data[i] != 0xFF || data[i+1]&0xE0 != 0xE0 {
+			continue
+		}
+		version := (data[i+1] >> 3) & 0x03 // 3 = MPEG-1, 2 = MPEG-2, 0 = MPEG-2.5
+		layer := (data[i+1] >> 1) & 0x03   // 1 = Layer III
+		index := data[i+2] >> 4
+		if version == 1 || layer != 1 || index == 0 || index == 15 {
+			continue
+		}
+		table := 1
+		if version == 3 {
+			table = 0
+		}
+		return mp3Bitrates[table][index] * 1000
+	}
+	return 0
+}
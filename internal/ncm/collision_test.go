@@ -0,0 +1,128 @@
+package ncm
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// mp3Frame returns an MPEG Layer III frame header followed by padding.
+func mp3Frame(b1, b2 byte) []byte {
+	return append([]byte{0xFF, b1, b2, 0x00}, make([]byte, 32)...)
+}
+
+// taggedMp3 returns audio behind an ID3v2.4 tag of size bytes (plus a footer
+// when flags has 0x10 set). The tag body is filled with frame-like bytes that
+// must not be mistaken for audio.
+func taggedMp3(size int, flags byte, audio []byte) []byte {
+	data := []byte{'I', 'D', '3', 4, 0, flags, byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+	for len(data) < 10+size {
+		data = append(data, 0xFF, 0xFB, 0xE0, 0x00)
+	}
+	data = data[:10+size]
+	if flags&0x10 != 0 {
+		data = append(data, '3', 'D', 'I', 4, 0, flags, data[6], data[7], data[8], data[9])
+	}
+	return append(data, audio...)
+}
+
+func TestProbeMp3Bitrate(t *testing.T) {
+	id3 := []byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0, 8}
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"MPEG-1 128k", mp3Frame(0xFB, 0x90), 128000},
+		{"MPEG-1 320k", mp3Frame(0xFB, 0xE0), 320000},
+		{"MPEG-2 64k", mp3Frame(0xF3, 0x80), 64000},
+		{"after junk", append([]byte{0, 1, 2, 0xFF, 0x00}, mp3Frame(0xFB, 0x90)...), 128000},
+		{"frame inside the ID3 tag ignored", append(append(id3, mp3Frame(0xFB, 0xE0)[:8]...), mp3Frame(0xFB, 0x90)...), 128000},
+		{"layer II", mp3Frame(0xFD, 0x90), 0},
+		{"reserved version", mp3Frame(0xEB, 0x90), 0},
+		{"free bitrate", mp3Frame(0xFB, 0x00), 0},
+		{"bad bitrate", mp3Frame(0xFB, 0xF0), 0},
+		{"truncated tag", id3[:8], 0},
+		{"empty", nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := probeMp3Bitrate(tt.data); got != tt.want {
+				t.Errorf("probeMp3Bitrate = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAudioQuality(t *testing.T) {
+	tests := []struct {
+		format  string
+		bitrate int
+		audio   []byte
+		want    int
+	}{
+		{"flac", 0, nil, losslessQuality},
+		{"flac", 999000, nil, losslessQuality},
+		{"mp3", 192000, mp3Frame(0xFB, 0xE0), 192000},
+		{"mp3", 0, mp3Frame(0xFB, 0xE0), 320000},
+		{"mp3", 0, nil, 0},
+	}
+	for _, tt := range tests {
+		if got := audioQuality(tt.format, tt.bitrate, tt.audio); got != tt.want {
+			t.Errorf("audioQuality(%s, %d) = %d, want %d", tt.format, tt.bitrate, got, tt.want)
+		}
+	}
+}
+
+func TestResolveCollision(t *testing.T) {
+	tests := []struct {
+		name      string
+		existing  map[string][]byte
+		path      string
+		policy    CollisionPolicy
+		quality   int
+		want      string
+		wantWorse []string
+		wantSkip  bool
+	}{
+		{"no file", nil, "Song.mp3", CollisionSkip, 128000, "Song.mp3", nil, false},
+		{"skip", map[string][]byte{"Song.mp3": nil}, "Song.mp3", CollisionSkip, 128000, "Song.mp3", nil, true},
+		{"overwrite", map[string][]byte{"Song.mp3": nil}, "Song.mp3", CollisionOverwrite, 128000, "Song.mp3", nil, false},
+		{"unknown policy overwrites", map[string][]byte{"Song.mp3": nil}, "Song.mp3", "", 128000, "Song.mp3", nil, false},
+		{"rename", map[string][]byte{"Song.mp3": nil, "Song (2).mp3": nil}, "Song.mp3", CollisionRename, 128000, "Song (3).mp3", nil, false},
+		{"rename free", map[string][]byte{"Song (2).mp3": nil}, "Song.mp3", CollisionRename, 128000, "Song.mp3", nil, false},
+		{"better bitrate replaces", map[string][]byte{"Song.mp3": mp3Frame(0xFB, 0x90)}, "Song.mp3", CollisionReplaceIfBetter, 320000, "Song.mp3", nil, false},
+		{"same bitrate skips", map[string][]byte{"Song.mp3": mp3Frame(0xFB, 0xE0)}, "Song.mp3", CollisionReplaceIfBetter, 320000, "Song.mp3", nil, true},
+		{"flac replaces mp3", map[string][]byte{"Song.mp3": mp3Frame(0xFB, 0xE0)}, "Song.flac", CollisionReplaceIfBetter, losslessQuality, "Song.flac", []string{"Song.mp3"}, false},
+		{"flac kept over mp3", map[string][]byte{"Song.flac": nil}, "Song.mp3", CollisionReplaceIfBetter, 320000, "Song.flac", nil, true},
+		{"unreadable mp3 kept", map[string][]byte{"Song.mp3": []byte("junk")}, "Song.mp3", CollisionReplaceIfBetter, 320000, "Song.mp3", nil, true},
+		{"large tag still probed", map[string][]byte{"Song.mp3": taggedMp3(600*1024, 0, mp3Frame(0xFB, 0x90))}, "Song.mp3", CollisionReplaceIfBetter, 320000, "Song.mp3", nil, false},
+		{"large tag with footer", map[string][]byte{"Song.mp3": taggedMp3(600*1024, 0x10, mp3Frame(0xFB, 0xE0))}, "Song.mp3", CollisionReplaceIfBetter, 320000, "Song.mp3", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, data := range tt.existing {
+				if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, worse, err := resolveCollision(filepath.Join(dir, tt.path), tt.policy, tt.quality)
+			if skipped := errors.Is(err, ErrSkipped); skipped != tt.wantSkip || (err != nil && !skipped) {
+				t.Fatalf("error = %v, want skipped %v", err, tt.wantSkip)
+			}
+			if want := filepath.Join(dir, tt.want); got != want {
+				t.Errorf("path = %q, want %q", got, want)
+			}
+			var wantWorse []string
+			for _, w := range tt.wantWorse {
+				wantWorse = append(wantWorse, filepath.Join(dir, w))
+			}
+			if !reflect.DeepEqual(worse, wantWorse) {
+				t.Errorf("worse = %q, want %q", worse, wantWorse)
+			}
+		})
+	}
+}
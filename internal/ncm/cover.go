@@ -0,0 +1,108 @@
+package ncm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	_ "image/gif" // register decoders for image.DecodeConfig
+	_ "image/jpeg"
+	_ "image/png"
+
+	flac "github.com/go-flac/go-flac"
+	_ "golang.org/x/image/webp"
+)
+
+// pictureTypeFrontCover is the APIC / FLAC PICTURE type for "Cover (front)".
+const pictureTypeFrontCover = 3
+
+// coverInfo describes an image as required by the FLAC PICTURE block and ID3 APIC frame.
+type coverInfo struct {
+	MimeType string
+	Width    int
+	Height   int
+	Depth    int // bits per pixel
+}
+
+// detectCover decodes the image header to find its format and dimensions.
+// Unknown or corrupt data falls back to image/jpeg with zero dimensions,
+// which is what NetEase covers almost always are.
+func detectCover(data []byte) coverInfo {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return coverInfo{MimeType: "image/jpeg"}
+	}
+	return coverInfo{
+		MimeType: "image/" + format,
+		Width:    cfg.Width,
+		Height:   cfg.Height,
+		Depth:    colorDepth(cfg.ColorModel),
+	}
+}
+
+// colorDepth returns the bits per pixel for the common image color models.
+func colorDepth(m color.Model) int {
+	switch m {
+	case color.GrayModel:
+		return 8
+	case color.Gray16Model:
+		return 16
+	case color.RGBAModel, color.NRGBAModel, color.CMYKModel:
+		return 32
+	case color.RGBA64Model, color.NRGBA64Model:
+		return 64
+	}
+	if _, ok := m.(color.Palette); ok {
+		return 8
+	}
+	return 24 // YCbCr (JPEG) and anything else
+}
+
+// buildFlacPictureBlock creates a front-cover PICTURE metadata block for FLAC.
+func buildFlacPictureBlock(cover []byte) *flac.MetaDataBlock {
+	// Binary layout: uint32 pic_type | uint32 mime_len | mime | uint32 desc_len | desc |
+	//                uint32 width | uint32 height | uint32 color_depth | uint32 color_count |
+	//                uint32 data_len | data
+	info := detectCover(cover)
+	mime := []byte(info.MimeType)
+	desc := []byte{}
+	var buf bytes.Buffer
+	writeUint32BE := func(v uint32) {
+		buf.Write([]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)})
+	}
+	writeUint32BE(pictureTypeFrontCover)
+	writeUint32BE(uint32(len(mime)))
+	buf.Write(mime)
+	writeUint32BE(uint32(len(desc)))
+	buf.Write(desc)
+	writeUint32BE(uint32(info.Width))
+	writeUint32BE(uint32(info.Height))
+	writeUint32BE(uint32(info.Depth))
+	writeUint32BE(0) // color count (0 for non-indexed images)
+	writeUint32BE(uint32(len(cover)))
+	buf.Write(cover)
+
+	return &flac.MetaDataBlock{
+		Type: flac.Picture,
+		Data: buf.Bytes(),
+	}
+}
+
+// isFrontCoverBlock reports whether m is a PICTURE block of type "front cover".
+func isFrontCoverBlock(m *flac.MetaDataBlock) bool {
+	if m.Type != flac.Picture || len(m.Data) < 4 {
+		return false
+	}
+	return binary.BigEndian.Uint32(m.Data[:4]) == pictureTypeFrontCover
+}
+
+// replaceFlacCover drops any existing front-cover PICTURE blocks and appends a new one.
+func replaceFlacCover(f *flac.File, cover []byte) {
+	kept := f.Meta[:0]
+	for _, m := range f.Meta {
+		if !isFrontCoverBlock(m) {
+			kept = append(kept, m)
+		}
+	}
+	f.Meta = append(kept, buildFlacPictureBlock(cover))
+}
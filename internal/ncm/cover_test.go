@@ -0,0 +1,136 @@
+package ncm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"testing"
+
+	flac "github.com/go-flac/go-flac"
+)
+
+// testImage returns a w×h image of random pixels, which compresses badly
+// and so makes size caps bite.
+func testImage(w, h int) *image.RGBA {
+	rng := rand.New(rand.NewSource(1))
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	rng.Read(img.Pix)
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 0xFF
+	}
+	return img
+}
+
+func encodeImage(t *testing.T, format string, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "png":
+		err = png.Encode(&buf, img)
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95})
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDetectCover(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want coverInfo
+	}{
+		{"png", encodeImage(t, "png", testImage(30, 20)), coverInfo{"image/png", 30, 20, 32}},
+		{"jpeg", encodeImage(t, "jpeg", testImage(16, 8)), coverInfo{"image/jpeg", 16, 8, 24}},
+		{"gray png", encodeImage(t, "png", image.NewGray(image.Rect(0, 0, 5, 5))), coverInfo{"image/png", 5, 5, 8}},
+		{"gif", encodeImage(t, "gif", testImage(4, 4)), coverInfo{"image/gif", 4, 4, 8}},
+		{"not an image", []byte("<html>"), coverInfo{MimeType: "image/jpeg"}},
+		{"empty", nil, coverInfo{MimeType: "image/jpeg"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectCover(tt.data); got != tt.want {
+				t.Errorf("detectCover = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+	if d := colorDepth(color.Palette{color.Black}); d != 8 {
+		t.Errorf("palette depth = %d", d)
+	}
+}
+
+// pictureBlock returns a PICTURE block of the given type.
+func pictureBlock(picType uint32) *flac.MetaDataBlock {
+	data := binary.BigEndian.AppendUint32(nil, picType)
+	return &flac.MetaDataBlock{Type: flac.Picture, Data: append(data, 0, 0, 0, 0)}
+}
+
+func TestBuildFlacPictureBlock(t *testing.T) {
+	cover := encodeImage(t, "png", testImage(30, 20))
+	b := buildFlacPictureBlock(cover)
+	if b.Type != flac.Picture || !isFrontCoverBlock(b) {
+		t.Fatalf("block type %v, front cover %v", b.Type, isFrontCoverBlock(b))
+	}
+	d := b.Data
+	u32 := func(off int) int { return int(binary.BigEndian.Uint32(d[off:])) }
+	mimeLen := u32(4)
+	if mime := string(d[8 : 8+mimeLen]); mime != "image/png" {
+		t.Errorf("mime = %q", mime)
+	}
+	off := 8 + mimeLen
+	off += 4 + u32(off) // description
+	if w, h, depth := u32(off), u32(off+4), u32(off+8); w != 30 || h != 20 || depth != 32 {
+		t.Errorf("size %dx%d depth %d", w, h, depth)
+	}
+	if n := u32(off + 16); n != len(cover) || !bytes.Equal(d[off+20:], cover) {
+		t.Errorf("data length %d, want %d", n, len(cover))
+	}
+}
+
+func TestReplaceFlacCover(t *testing.T) {
+	const backCover = 4
+	streamInfo := &flac.MetaDataBlock{Type: flac.StreamInfo}
+	comment := &flac.MetaDataBlock{Type: flac.VorbisComment}
+	back := pictureBlock(backCover)
+	tests := []struct {
+		name string
+		meta []*flac.MetaDataBlock
+		keep []*flac.MetaDataBlock // blocks expected before the new cover
+	}{
+		{"no cover", []*flac.MetaDataBlock{streamInfo, comment}, []*flac.MetaDataBlock{streamInfo, comment}},
+		{"front cover replaced", []*flac.MetaDataBlock{streamInfo, pictureBlock(pictureTypeFrontCover), comment},
+			[]*flac.MetaDataBlock{streamInfo, comment}},
+		{"duplicates dropped", []*flac.MetaDataBlock{streamInfo, pictureBlock(pictureTypeFrontCover), pictureBlock(pictureTypeFrontCover)},
+			[]*flac.MetaDataBlock{streamInfo}},
+		{"other pictures kept", []*flac.MetaDataBlock{streamInfo, back, pictureBlock(pictureTypeFrontCover)},
+			[]*flac.MetaDataBlock{streamInfo, back}},
+	}
+	cover := encodeImage(t, "jpeg", testImage(8, 8))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &flac.File{Meta: append([]*flac.MetaDataBlock(nil), tt.meta...)}
+			replaceFlacCover(f, cover)
+			if len(f.Meta) != len(tt.keep)+1 {
+				t.Fatalf("%d blocks, want %d", len(f.Meta), len(tt.keep)+1)
+			}
+			for i, b := range tt.keep {
+				if f.Meta[i] != b {
+					t.Errorf("block %d = %v, want %v", i, f.Meta[i].Type, b.Type)
+				}
+			}
+			if last := f.Meta[len(f.Meta)-1]; !isFrontCoverBlock(last) {
+				t.Error("new cover is not a front cover")
+			}
+		})
+	}
+}
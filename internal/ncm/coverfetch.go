@@ -0,0 +1,196 @@
+package ncm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCoverFetchMaxBytes caps a downloaded cover. NetEase originals are
+// rarely above 2 MB.
+const DefaultCoverFetchMaxBytes = 20 << 20
+
+// defaultCoverClient is used when CoverFetcher.Client is nil.
+var defaultCoverClient = &http.Client{Timeout: 10 * time.Second}
+
+// ErrOffline is returned by CoverFetcher.Fetch in offline mode when the
+// cover is not cached.
+var ErrOffline = errors.New("offline mode: cover not cached")
+
+// CoverFetcher downloads cover art by URL, keeping a copy of each image in a
+// disk cache so tracks of the same album download it once. Concurrent
+// fetches of one URL share a single download. The zero value downloads with
+// a 10s timeout and caches nothing.
+type CoverFetcher struct {
+	// Client performs the requests; nil uses a client with a 10s timeout.
+	// Tests can pass a client whose Transport points at an httptest server.
+	Client *http.Client
+	// CacheDir holds cached covers, one file per URL; "" disables the cache.
+	CacheDir string
+	// Offline serves covers from the cache only and never touches the network.
+	Offline bool
+	// MaxBytes caps the response size; 0 = DefaultCoverFetchMaxBytes.
+	MaxBytes int64
+
+	mu       sync.Mutex
+	inflight map[string]*coverCall // by URL, while it is being downloaded
+}
+
+// coverCall is a download shared by the fetches of one URL.
+type coverCall struct {
+	done chan struct{} // closed once data and err are set
+	data []byte
+	err  error
+}
+
+// Fetch returns the image at rawURL, from the cache when present. Only http
+// and https URLs are fetched, and the response must be a 200 with an image
+// body; anything else (e.g. a 404 HTML page) is an error.
+func (f *CoverFetcher) Fetch(rawURL string) ([]byte, error) {
+	return f.FetchContext(context.Background(), rawURL)
+}
+
+// FetchContext is like Fetch but abandons the download when ctx is cancelled.
+func (f *CoverFetcher) FetchContext(ctx context.Context, rawURL string) ([]byte, error) {
+	if f == nil {
+		f = &CoverFetcher{}
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("cover url: unsupported scheme %q", u.Scheme)
+	}
+
+	cachePath := f.cachePath(rawURL)
+	if cachePath != "" {
+		if data, err := os.ReadFile(cachePath); err == nil && len(data) > 0 {
+			return data, nil
+		}
+	}
+	if f.Offline {
+		return nil, ErrOffline
+	}
+
+	for {
+		data, shared, err := f.fetch(ctx, rawURL, cachePath)
+		// A download cancelled by the fetch that started it is tried again
+		// by those that were waiting for it
+		if shared && errors.Is(err, context.Canceled) && ctx.Err() == nil {
+			continue
+		}
+		return data, err
+	}
+}
+
+// fetch downloads rawURL into the cache, or waits for the download already
+// running for it. shared reports whether another call did the download.
+func (f *CoverFetcher) fetch(ctx context.Context, rawURL, cachePath string) (data []byte, shared bool, err error) {
+	f.mu.Lock()
+	if c, ok := f.inflight[rawURL]; ok {
+		f.mu.Unlock()
+		select {
+		case <-c.done:
+			return c.data, true, c.err
+		case <-ctx.Done():
+			return nil, true, ctx.Err()
+		}
+	}
+	c := &coverCall{done: make(chan struct{})}
+	if f.inflight == nil {
+		f.inflight = map[string]*coverCall{}
+	}
+	f.inflight[rawURL] = c
+	f.mu.Unlock()
+
+	defer func() {
+		f.mu.Lock()
+		delete(f.inflight, rawURL)
+		f.mu.Unlock()
+		close(c.done)
+	}()
+	c.data, c.err = f.download(ctx, rawURL)
+	if c.err == nil && cachePath != "" {
+		// A failed cache write only costs a download next time
+		if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err == nil {
+			_ = writeAtomic(cachePath, func(w io.Writer) error {
+				_, err := w.Write(c.data)
+				return err
+			})
+		}
+	}
+	return c.data, false, c.err
+}
+
+// download performs the request and validates the response.
+func (f *CoverFetcher) download(ctx context.Context, rawURL string) ([]byte, error) {
+	client := f.Client
+	if client == nil {
+		client = defaultCoverClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cover download: %s", resp.Status)
+	}
+	// Redirects must not lead off http(s) either
+	if s := resp.Request.URL.Scheme; s != "http" && s != "https" {
+		return nil, fmt.Errorf("cover url: unsupported scheme %q", s)
+	}
+
+	limit := f.MaxBytes
+	if limit <= 0 {
+		limit = DefaultCoverFetchMaxBytes
+	}
+	if resp.ContentLength > limit {
+		return nil, fmt.Errorf("cover download: %d bytes exceeds the %d byte limit", resp.ContentLength, limit)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("cover download: response exceeds the %d byte limit", limit)
+	}
+	if len(data) == 0 {
+		return nil, errors.New("cover download: empty response")
+	}
+
+	// CDNs sometimes label images application/octet-stream, so the body is
+	// sniffed when the header is not an image type
+	ct, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !strings.HasPrefix(ct, "image/") && !strings.HasPrefix(http.DetectContentType(data), "image/") {
+		return nil, fmt.Errorf("cover download: not an image (%s)", resp.Header.Get("Content-Type"))
+	}
+	return data, nil
+}
+
+// cachePath returns the cache file for rawURL, named by the SHA-256 of the
+// URL and sharded by its first byte, or "" when caching is off.
+func (f *CoverFetcher) cachePath(rawURL string) string {
+	if f.CacheDir == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(rawURL))
+	key := hex.EncodeToString(sum[:])
+	return filepath.Join(f.CacheDir, key[:2], key)
+}
@@ -0,0 +1,250 @@
+package ncm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// coverServer serves a PNG under several guises and counts requests.
+func coverServer(t *testing.T, img []byte) (*httptest.Server, *atomic.Int32) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		switch r.URL.Path {
+		case "/cover.png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write(img)
+		case "/octet":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			_, _ = w.Write(img)
+		case "/page":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte("<html><body>not found</body></html>"))
+		case "/empty":
+			w.Header().Set("Content-Type", "image/png")
+		case "/big":
+			// No Content-Length, so the limit is enforced while reading
+			w.Header().Set("Content-Type", "image/png")
+			w.(http.Flusher).Flush()
+			_, _ = w.Write(bytes.Repeat(img, 100))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+func TestCoverFetch(t *testing.T) {
+	img := testPNG(t)
+	srv, _ := coverServer(t, img)
+	tests := []struct {
+		name    string
+		url     string
+		max     int64
+		wantErr string
+	}{
+		{"image", srv.URL + "/cover.png", 0, ""},
+		{"image sniffed from the body", srv.URL + "/octet", 0, ""},
+		{"not found", srv.URL + "/missing", 0, "404"},
+		{"not an image", srv.URL + "/page", 0, "not an image"},
+		{"empty", srv.URL + "/empty", 0, "empty"},
+		{"content length over the cap", srv.URL + "/cover.png", int64(len(img) - 1), "limit"},
+		{"body over the cap", srv.URL + "/big", int64(len(img) * 10), "limit"},
+		{"file scheme", "file:///etc/passwd", 0, "unsupported scheme"},
+		{"ftp scheme", "ftp://example.com/cover.jpg", 0, "unsupported scheme"},
+		{"no scheme", "/cover.png", 0, "unsupported scheme"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &CoverFetcher{Client: srv.Client(), MaxBytes: tt.max}
+			data, err := f.Fetch(tt.url)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(data, img) {
+					t.Errorf("got %d bytes, want the %d byte image", len(data), len(img))
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCoverFetchCache(t *testing.T) {
+	img := testPNG(t)
+	srv, hits := coverServer(t, img)
+	dir := t.TempDir()
+	url := srv.URL + "/cover.png"
+
+	f := &CoverFetcher{Client: srv.Client(), CacheDir: dir}
+	for range 3 {
+		data, err := f.Fetch(url)
+		if err != nil || !bytes.Equal(data, img) {
+			t.Fatalf("Fetch = %d bytes, %v", len(data), err)
+		}
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("%d requests for one cover, want 1", n)
+	}
+
+	// Failed downloads are not cached
+	if _, err := f.Fetch(srv.URL + "/page"); err == nil {
+		t.Fatal("html page accepted")
+	}
+	if _, err := f.Fetch(srv.URL + "/page"); err == nil {
+		t.Fatal("html page accepted from the cache")
+	}
+
+	offline := &CoverFetcher{CacheDir: dir, Offline: true}
+	if data, err := offline.Fetch(url); err != nil || !bytes.Equal(data, img) {
+		t.Errorf("offline cache hit = %d bytes, %v", len(data), err)
+	}
+	before := hits.Load()
+	if _, err := offline.Fetch(srv.URL + "/octet"); !errors.Is(err, ErrOffline) {
+		t.Errorf("offline miss: %v, want ErrOffline", err)
+	}
+	if hits.Load() != before {
+		t.Error("offline mode made a request")
+	}
+	if _, err := (&CoverFetcher{Offline: true}).Fetch(url); !errors.Is(err, ErrOffline) {
+		t.Errorf("offline without a cache: %v, want ErrOffline", err)
+	}
+}
+
+func TestCoverFetchCancelled(t *testing.T) {
+	srv, _ := coverServer(t, testPNG(t))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	f := &CoverFetcher{Client: srv.Client(), CacheDir: t.TempDir()}
+	if _, err := f.FetchContext(ctx, srv.URL+"/cover.png"); !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, want context.Canceled", err)
+	}
+}
+
+// slowCoverServer serves img once release is closed, counting requests.
+func slowCoverServer(t *testing.T, img []byte, release <-chan struct{}) (*httptest.Server, *atomic.Int32) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write(img)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+// waitHits waits until the server has seen n requests.
+func waitHits(t *testing.T, hits *atomic.Int32, n int32) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for hits.Load() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d requests, want %d", hits.Load(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCoverFetchShared(t *testing.T) {
+	img := testPNG(t)
+	release := make(chan struct{})
+	srv, hits := slowCoverServer(t, img, release)
+	// No cache, so only sharing the download avoids a second request
+	f := &CoverFetcher{Client: srv.Client()}
+
+	const fetches = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, fetches)
+	fetch := func() {
+		defer wg.Done()
+		data, err := f.FetchContext(context.Background(), srv.URL+"/cover.png")
+		if err == nil && !bytes.Equal(data, img) {
+			err = errors.New("wrong image")
+		}
+		errs <- err
+	}
+	wg.Add(1)
+	go fetch()
+	waitHits(t, hits, 1)
+	for range fetches - 1 {
+		wg.Add(1)
+		go fetch()
+	}
+	time.Sleep(50 * time.Millisecond) // let them find the download running
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("%d downloads, want 1", n)
+	}
+}
+
+func TestCoverFetchSharedCancelled(t *testing.T) {
+	img := testPNG(t)
+	release := make(chan struct{})
+	srv, hits := slowCoverServer(t, img, release)
+	f := &CoverFetcher{Client: srv.Client()}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := f.FetchContext(ctx, srv.URL+"/cover.png")
+		first <- err
+	}()
+	waitHits(t, hits, 1)
+	second := make(chan error, 1)
+	go func() {
+		data, err := f.FetchContext(context.Background(), srv.URL+"/cover.png")
+		if err == nil && !bytes.Equal(data, img) {
+			err = errors.New("wrong image")
+		}
+		second <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// The waiting fetch downloads again rather than failing with the
+	// first one's cancellation
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled fetch: %v", err)
+	}
+	waitHits(t, hits, 2)
+	close(release)
+	if err := <-second; err != nil {
+		t.Errorf("waiting fetch: %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package ncm
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+const (
+	// DefaultCoverJPEGQuality is used when CoverOptions.JPEGQuality is 0.
+	DefaultCoverJPEGQuality = 90
+
+	// minCoverJPEGQuality is the lowest quality tried when shrinking to MaxBytes.
+	minCoverJPEGQuality = 50
+	// minCoverDimension stops the size-cap loop from producing thumbnails.
+	minCoverDimension = 200
+)
+
+// CoverOptions controls how cover art is processed before it is embedded.
+// The zero value leaves covers untouched.
+type CoverOptions struct {
+	MaxDimension  int  // longest edge in pixels; 0 = keep original size
+	JPEGQuality   int  // 1–100; 0 = DefaultCoverJPEGQuality
+	MaxBytes      int  // upper bound for the encoded image; 0 = unlimited
+	ConvertToJPEG bool // re-encode PNG / WebP / GIF covers as JPEG
+}
+
+func (o CoverOptions) quality() int {
+	if o.JPEGQuality <= 0 || o.JPEGQuality > 100 {
+		return DefaultCoverJPEGQuality
+	}
+	return o.JPEGQuality
+}
+
+// ProcessCover resizes, converts and recompresses cover art according to opts.
+// Data that needs no processing is returned as-is. On error the caller should
+// fall back to the original bytes.
+func ProcessCover(data []byte, opts CoverOptions) ([]byte, error) {
+	if len(data) == 0 {
+		return data, nil
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return data, err
+	}
+
+	needResize := opts.MaxDimension > 0 && max(cfg.Width, cfg.Height) > opts.MaxDimension
+	needConvert := opts.ConvertToJPEG && format != "jpeg"
+	needShrink := opts.MaxBytes > 0 && len(data) > opts.MaxBytes
+	if !needResize && !needConvert && !needShrink {
+		return data, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return data, err
+	}
+	if needResize {
+		img = scaleToFit(img, opts.MaxDimension)
+	}
+
+	// PNG and GIF stay lossless unless conversion or a size cap forces JPEG.
+	// WebP has no pure-Go encoder, so it is always re-encoded as JPEG.
+	if !needConvert && !needShrink && (format == "png" || format == "gif") {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return data, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	out, err := encodeJPEG(img, opts.quality())
+	if err != nil {
+		return data, err
+	}
+	if opts.MaxBytes <= 0 {
+		return out, nil
+	}
+
+	// Size cap: lower the quality first, then shrink the image.
+	for q := opts.quality(); len(out) > opts.MaxBytes && q > minCoverJPEGQuality; {
+		q = max(q-10, minCoverJPEGQuality)
+		if out, err = encodeJPEG(img, q); err != nil {
+			return data, err
+		}
+	}
+	for len(out) > opts.MaxBytes {
+		b := img.Bounds()
+		edge := max(b.Dx(), b.Dy()) * 3 / 4
+		if edge < minCoverDimension {
+			break // best effort
+		}
+		img = scaleToFit(img, edge)
+		if out, err = encodeJPEG(img, minCoverJPEGQuality); err != nil {
+			return data, err
+		}
+	}
+	return out, nil
+}
+
+// scaleToFit scales img so its longest edge is at most maxEdge pixels.
+func scaleToFit(img image.Image, maxEdge int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= maxEdge && h <= maxEdge {
+		return img
+	}
+	if w >= h {
+		h = max(1, h*maxEdge/w)
+		w = maxEdge
+	} else {
+		w = max(1, w*maxEdge/h)
+		h = maxEdge
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// encodeJPEG encodes img as JPEG, flattening any transparency onto white.
+func encodeJPEG(img image.Image, quality int) ([]byte, error) {
+	if !isOpaque(img) {
+		b := img.Bounds()
+		flat := image.NewRGBA(b)
+		draw.Draw(flat, b, image.NewUniform(color.White), image.Point{}, draw.Src)
+		draw.Draw(flat, b, img, b.Min, draw.Over)
+		img = flat
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// isOpaque reports whether img is known to have no transparent pixels.
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package ncm
+
+import (
+	"bytes"
+	"image"
+	"testing"
+)
+
+func TestProcessCover(t *testing.T) {
+	bigJPEG := encodeImage(t, "jpeg", testImage(800, 600))
+	smallPNG := encodeImage(t, "png", testImage(100, 100))
+	transparent := image.NewNRGBA(image.Rect(0, 0, 300, 300)) // all transparent
+	tests := []struct {
+		name       string
+		data       []byte
+		opts       CoverOptions
+		wantSame   bool   // returned unchanged
+		wantFormat string // "" = not checked
+		maxEdge    int
+		maxBytes   int
+	}{
+		{name: "zero options", data: bigJPEG, wantSame: true},
+		{name: "small enough", data: bigJPEG, opts: CoverOptions{MaxDimension: 1000, MaxBytes: len(bigJPEG)}, wantSame: true},
+		{name: "jpeg already", data: bigJPEG, opts: CoverOptions{ConvertToJPEG: true}, wantSame: true},
+		{name: "resized", data: bigJPEG, opts: CoverOptions{MaxDimension: 400}, wantFormat: "jpeg", maxEdge: 400},
+		{name: "png resized stays png", data: encodeImage(t, "png", testImage(400, 100)), opts: CoverOptions{MaxDimension: 200}, wantFormat: "png", maxEdge: 200},
+		{name: "png converted", data: smallPNG, opts: CoverOptions{ConvertToJPEG: true}, wantFormat: "jpeg", maxEdge: 100},
+		{name: "transparent png flattened", data: encodeImage(t, "png", transparent), opts: CoverOptions{ConvertToJPEG: true}, wantFormat: "jpeg"},
+		{name: "size cap", data: bigJPEG, opts: CoverOptions{MaxBytes: 60 << 10}, wantFormat: "jpeg", maxBytes: 60 << 10},
+		{name: "png over the cap becomes jpeg", data: smallPNG, opts: CoverOptions{MaxBytes: len(smallPNG) / 2}, wantFormat: "jpeg"},
+		{name: "empty", data: nil, opts: CoverOptions{MaxDimension: 10}, wantSame: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := ProcessCover(tt.data, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if same := bytes.Equal(out, tt.data); same != tt.wantSame {
+				t.Fatalf("unchanged = %v, want %v", same, tt.wantSame)
+			}
+			if tt.wantSame {
+				return
+			}
+			cfg, format, err := image.DecodeConfig(bytes.NewReader(out))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantFormat != "" && format != tt.wantFormat {
+				t.Errorf("format = %s, want %s", format, tt.wantFormat)
+			}
+			if tt.maxEdge > 0 && max(cfg.Width, cfg.Height) != tt.maxEdge {
+				t.Errorf("size %dx%d, want longest edge %d", cfg.Width, cfg.Height, tt.maxEdge)
+			}
+			if tt.maxBytes > 0 && len(out) > tt.maxBytes {
+				t.Errorf("%d bytes, cap %d", len(out), tt.maxBytes)
+			}
+		})
+	}
+
+	if _, err := ProcessCover([]byte("not an image"), CoverOptions{MaxDimension: 10}); err == nil {
+		t.Error("junk accepted")
+	}
+}
+
+func TestScaleToFit(t *testing.T) {
+	tests := []struct {
+		w, h, edge int
+		wantW      int
+		wantH      int
+	}{
+		{800, 600, 400, 400, 300},
+		{600, 800, 400, 300, 400},
+		{1000, 1, 100, 100, 1},
+		{300, 200, 400, 300, 200},
+	}
+	for _, tt := range tests {
+		b := scaleToFit(image.NewRGBA(image.Rect(0, 0, tt.w, tt.h)), tt.edge).Bounds()
+		if b.Dx() != tt.wantW || b.Dy() != tt.wantH {
+			t.Errorf("scaleToFit(%dx%d, %d) = %dx%d, want %dx%d", tt.w, tt.h, tt.edge, b.Dx(), b.Dy(), tt.wantW, tt.wantH)
+		}
+	}
+}
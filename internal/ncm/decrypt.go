@@ -2,10 +2,12 @@ package ncm
 
 import (
 	"bytes"
+	"context"
 	"crypto/aes"
 	"encoding/base64"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 )
@@ -33,38 +35,123 @@ type DecryptResult struct {
 
 // DecryptFile reads an NCM file and decrypts it, returning audio bytes and metadata.
 func DecryptFile(path string) (*DecryptResult, error) {
+	return DecryptFileContext(context.Background(), path, nil)
+}
+
+// DecryptFileContext is like DecryptFile but reports the reading and
+// decrypting stages to report, which may be nil, and stops with ctx's error
+// when ctx is cancelled, checking between chunks. Between chunks it also
+// waits while the context's PauseGate (see WithPauseGate) is paused.
+func DecryptFileContext(ctx context.Context, path string, report ProgressFunc) (*DecryptResult, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
-	return Decrypt(f)
+	var size int64
+	if fi, err := f.Stat(); err == nil {
+		size = fi.Size()
+	}
+	report.report(StageReading, 0, size)
+	return decrypt(ctx, &countingReader{ctx: ctx, r: f, stage: StageReading, total: size, fn: report}, report)
 }
 
 // Decrypt performs the full NCM decryption pipeline on the given reader.
 func Decrypt(r io.Reader) (*DecryptResult, error) {
+	return DecryptContext(context.Background(), r)
+}
+
+// DecryptContext is like Decrypt but stops with ctx's error when ctx is
+// cancelled.
+func DecryptContext(ctx context.Context, r io.Reader) (*DecryptResult, error) {
+	return decrypt(ctx, &countingReader{ctx: ctx, r: r, stage: StageReading}, nil)
+}
+
+func decrypt(ctx context.Context, r io.Reader, report ProgressFunc) (*DecryptResult, error) {
+	// A metadata error is non-fatal: audio decryption continues, and MetaErr
+	// is surfaced to the caller so it can fall back to the file name
+	rc4Key, meta, metaErr, err := readKeyAndMeta(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// 4. Skip CRC32 (4 bytes) + gap (5 bytes)
+	if _, err := io.ReadFull(r, make([]byte, 9)); err != nil {
+		return nil, err
+	}
+
+	// 5. Read & skip embedded cover image
+	coverImgLen, err := readUint32LE(r)
+	if err != nil {
+		return nil, err
+	}
+	var coverData []byte
+	if coverImgLen > 0 {
+		coverData = make([]byte, coverImgLen)
+		if _, err := io.ReadFull(r, coverData); err != nil {
+			return nil, err
+		}
+	}
+
+	// 6. Build RC4 keystream (using the S-Box / KSA algorithm as NCM uses)
+	keyBox := buildRC4KeyBox(rc4Key)
+
+	// 7. Decrypt audio stream via XOR
+	audio, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	total := int64(len(audio))
+	for off := 0; off < len(audio); off += progressChunk {
+		if err := checkpoint(ctx); err != nil {
+			return nil, err
+		}
+		end := min(off+progressChunk, len(audio))
+		applyKeystream(&keyBox, audio[off:end], int64(off))
+		report.report(StageDecrypting, int64(end), total)
+	}
+
+	// 8. Detect actual format from audio header
+	format := detectFormat(audio)
+	if meta.Format == "" {
+		meta.Format = format
+	}
+
+	return &DecryptResult{
+		Meta:      meta,
+		Audio:     audio,
+		CoverData: coverData,
+		Format:    format,
+		MetaErr:   metaErr,
+	}, nil
+}
+
+// readKeyAndMeta reads the NCM header up to and including the metadata block.
+// It returns the RC4 key and the parsed metadata. A metadata parse failure is
+// reported via metaErr (with an empty Meta) rather than err.
+func readKeyAndMeta(r io.Reader) (rc4Key []byte, meta *Meta, metaErr error, err error) {
 	// 1. Validate magic header
 	magic := make([]byte, 8)
 	if _, err := io.ReadFull(r, magic); err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 	if !bytes.Equal(magic, magicHeader) {
-		return nil, errors.New("not a valid NCM file: magic header mismatch")
+		return nil, nil, nil, errors.New("not a valid NCM file: magic header mismatch")
 	}
 
 	// Skip 2 gap bytes
 	if _, err := io.ReadFull(r, make([]byte, 2)); err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 
 	// 2. Read & decrypt the RC4 key block (AES-128-ECB with coreKey)
 	keyLen, err := readUint32LE(r)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 	keyData := make([]byte, keyLen)
 	if _, err := io.ReadFull(r, keyData); err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 	// XOR each byte with 0x64
 	for i := range keyData {
@@ -72,102 +159,106 @@ func Decrypt(r io.Reader) (*DecryptResult, error) {
 	}
 	decryptedKey, err := aesECBDecrypt(keyData, coreKey)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 	// decryptedKey starts with "neteasecloudmusic" prefix — skip it
 	const keyPrefix = "neteasecloudmusic"
 	if len(decryptedKey) > len(keyPrefix) && string(decryptedKey[:len(keyPrefix)]) == keyPrefix {
 		decryptedKey = decryptedKey[len(keyPrefix):]
 	}
-	rc4Key := decryptedKey
+	rc4Key = decryptedKey
 
 	// 3. Read & decrypt metadata block (AES-128-ECB with metaKey)
 	metaLen, err := readUint32LE(r)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
-	var meta *Meta
-	var coverData []byte
-	if metaLen > 0 {
-		metaData := make([]byte, metaLen)
-		if _, err := io.ReadFull(r, metaData); err != nil {
-			return nil, err
-		}
-		// XOR each byte with 0x63
-		for i := range metaData {
-			metaData[i] ^= 0x63
-		}
-		// Strip the "163 key(Don't modify):" header before base64
-		const metaPrefix = "163 key(Don't modify):"
-		if len(metaData) > len(metaPrefix) && string(metaData[:len(metaPrefix)]) == metaPrefix {
-			metaData = metaData[len(metaPrefix):]
-		}
-		decoded, err := base64.StdEncoding.DecodeString(string(metaData))
-		if err != nil {
-			decoded, err = base64.RawStdEncoding.DecodeString(string(metaData))
-			if err != nil {
-				return nil, err
-			}
-		}
-		metaDecrypted, err := aesECBDecrypt(decoded, metaKey)
+	if metaLen == 0 {
+		return rc4Key, &Meta{}, nil, nil
+	}
+	metaData := make([]byte, metaLen)
+	if _, err := io.ReadFull(r, metaData); err != nil {
+		return nil, nil, nil, err
+	}
+	// XOR each byte with 0x63
+	for i := range metaData {
+		metaData[i] ^= 0x63
+	}
+	// Strip the "163 key(Don't modify):" header before base64
+	const metaPrefix = "163 key(Don't modify):"
+	if len(metaData) > len(metaPrefix) && string(metaData[:len(metaPrefix)]) == metaPrefix {
+		metaData = metaData[len(metaPrefix):]
+	}
+	decoded, err := base64.StdEncoding.DecodeString(string(metaData))
+	if err != nil {
+		decoded, err = base64.RawStdEncoding.DecodeString(string(metaData))
 		if err != nil {
-			return nil, err
-		}
-		var metaErr error
-		meta, metaErr = parseMeta(metaDecrypted)
-		if metaErr != nil {
-			// Non-fatal: audio decryption continues, but MetaErr is surfaced
-			// to the caller so it can be logged or shown in the UI.
-			meta = &Meta{}
-			coverData = nil // can't trust cover either
-			return &DecryptResult{Meta: meta, MetaErr: metaErr}, nil
+			// The metadata block is self-contained, so a corrupt one does
+			// not stop the audio from being decrypted
+			return rc4Key, &Meta{}, fmt.Errorf("decode metadata: %w", err), nil
 		}
-	} else {
-		meta = &Meta{}
 	}
+	metaDecrypted, err := aesECBDecrypt(decoded, metaKey)
+	if err != nil {
+		return rc4Key, &Meta{}, fmt.Errorf("decrypt metadata: %w", err), nil
+	}
+	meta, metaErr = parseMeta(metaDecrypted)
+	if metaErr != nil {
+		return rc4Key, &Meta{}, metaErr, nil
+	}
+	return rc4Key, meta, nil, nil
+}
 
-	// 4. Skip CRC32 (4 bytes) + gap (5 bytes)
-	if _, err := io.ReadFull(r, make([]byte, 9)); err != nil {
+// ProbeResult holds what Probe learns about an NCM file without decrypting the audio.
+type ProbeResult struct {
+	Meta    *Meta
+	Format  string // "mp3" or "flac", detected from the first audio bytes
+	MetaErr error  // see DecryptResult.MetaErr
+}
+
+// ProbeFile reads only the header, metadata and first audio bytes of an NCM file.
+func ProbeFile(path string) (*ProbeResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
+	return Probe(f)
+}
 
-	// 5. Read & skip embedded cover image
-	coverImgLen, err := readUint32LE(r)
+// Probe reads the metadata of an NCM stream and detects the audio format,
+// skipping the cover and decrypting only the first audio bytes.
+func Probe(r io.Reader) (*ProbeResult, error) {
+	rc4Key, meta, metaErr, err := readKeyAndMeta(r)
 	if err != nil {
 		return nil, err
 	}
-	if coverImgLen > 0 {
-		coverData = make([]byte, coverImgLen)
-		if _, err := io.ReadFull(r, coverData); err != nil {
-			return nil, err
-		}
+	// Skip CRC32 (4 bytes) + gap (5 bytes), then the embedded cover
+	if _, err := io.CopyN(io.Discard, r, 9); err != nil {
+		return nil, err
 	}
-
-	// 6. Build RC4 keystream (using the S-Box / KSA algorithm as NCM uses)
-	keyBox := buildRC4KeyBox(rc4Key)
-
-	// 7. Decrypt audio stream via XOR
-	audio, err := io.ReadAll(r)
+	coverImgLen, err := readUint32LE(r)
 	if err != nil {
 		return nil, err
 	}
-	for i := range audio {
-		j := (i + 1) & 0xFF
-		audio[i] ^= keyBox[(int(keyBox[j])+int(keyBox[(int(j)+int(keyBox[j]))&0xFF]))&0xFF]
+	if _, err := io.CopyN(io.Discard, r, int64(coverImgLen)); err != nil {
+		return nil, err
 	}
 
-	// 8. Detect actual format from audio header
-	format := detectFormat(audio)
+	head := make([]byte, 4)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	head = head[:n]
+	keyBox := buildRC4KeyBox(rc4Key)
+	applyKeystream(&keyBox, head, 0)
+
+	format := detectFormat(head)
 	if meta.Format == "" {
 		meta.Format = format
 	}
-
-	return &DecryptResult{
-		Meta:      meta,
-		Audio:     audio,
-		CoverData: coverData,
-		Format:    format,
-	}, nil
+	return &ProbeResult{Meta: meta, Format: format, MetaErr: metaErr}, nil
 }
 
 // buildRC4KeyBox constructs the NCM-specific RC4 S-Box (KSA step).
@@ -185,6 +276,16 @@ func buildRC4KeyBox(key []byte) [256]byte {
 	return box
 }
 
+// applyKeystream XORs data in place with the NCM keystream. offset is the
+// position of data[0] within the audio stream, so chunks can be decrypted
+// independently.
+func applyKeystream(box *[256]byte, data []byte, offset int64) {
+	for i := range data {
+		j := int((offset + int64(i) + 1) & 0xFF)
+		data[i] ^= box[(int(box[j])+int(box[(j+int(box[j]))&0xFF]))&0xFF]
+	}
+}
+
 // detectFormat inspects the first few bytes to determine if audio is MP3 or FLAC.
 func detectFormat(data []byte) string {
 	if len(data) >= 4 {
@@ -0,0 +1,142 @@
+package ncm
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// fallbackFields are the placeholders a fallback pattern may use.
+var fallbackFields = map[string]bool{"title": true, "artist": true, "album": true, "track": true}
+
+// FallbackPattern matches a source file name against a pattern such as
+// "{artist} - {title}" to recover metadata.
+type FallbackPattern struct {
+	pattern string
+	re      *regexp.Regexp
+	fields  []string // placeholder names in group order
+}
+
+// fallbackPlaceholder finds "{name}" in a fallback pattern.
+var fallbackPlaceholder = regexp.MustCompile(`\{(\w+)\}`)
+
+// ParseFallbackPattern compiles a fallback pattern. Literal text must match
+// exactly except that spaces match any run of whitespace; {track} matches
+// digits only.
+func ParseFallbackPattern(pattern string) (*FallbackPattern, error) {
+	fp := &FallbackPattern{pattern: pattern}
+	var expr strings.Builder
+	expr.WriteString(`^\s*`)
+	last := 0
+	for _, loc := range fallbackPlaceholder.FindAllStringSubmatchIndex(pattern, -1) {
+		expr.WriteString(literalExpr(pattern[last:loc[0]]))
+		name := pattern[loc[2]:loc[3]]
+		if !fallbackFields[name] {
+			return nil, fmt.Errorf("文件名解析规则 %q：未知占位符 {%s}", pattern, name)
+		}
+		for _, f := range fp.fields {
+			if f == name {
+				return nil, fmt.Errorf("文件名解析规则 %q：{%s} 重复", pattern, name)
+			}
+		}
+		if name == "track" {
+			expr.WriteString(`(\d{1,3})`)
+		} else {
+			expr.WriteString(`(.+?)`)
+		}
+		fp.fields = append(fp.fields, name)
+		last = loc[1]
+	}
+	expr.WriteString(literalExpr(pattern[last:]))
+	expr.WriteString(`\s*$`)
+	if len(fp.fields) == 0 {
+		return nil, fmt.Errorf("文件名解析规则 %q 中没有占位符", pattern)
+	}
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, fmt.Errorf("文件名解析规则 %q：%v", pattern, err)
+	}
+	fp.re = re
+	return fp, nil
+}
+
+// literalExpr quotes literal pattern text, letting spaces match any whitespace.
+func literalExpr(s string) string {
+	parts := strings.Fields(s)
+	for i, p := range parts {
+		parts[i] = regexp.QuoteMeta(p)
+	}
+	expr := strings.Join(parts, `\s+`)
+	if strings.HasPrefix(s, " ") {
+		expr = `\s+` + expr
+	}
+	if strings.HasSuffix(s, " ") && len(parts) > 0 {
+		expr += `\s+`
+	}
+	return expr
+}
+
+// String returns the source pattern.
+func (fp *FallbackPattern) String() string { return fp.pattern }
+
+// match returns the placeholder values for name, or nil when it does not match.
+func (fp *FallbackPattern) match(name string) map[string]string {
+	m := fp.re.FindStringSubmatch(name)
+	if m == nil {
+		return nil
+	}
+	vals := map[string]string{}
+	for i, f := range fp.fields {
+		if v := strings.TrimSpace(m[i+1]); v != "" {
+			vals[f] = v
+		}
+	}
+	return vals
+}
+
+// artistListSplit separates the artists in a NetEase file name ("A,B - Title").
+var artistListSplit = regexp.MustCompile(`\s*[,，、/]\s*`)
+
+// NeedsFallback reports whether meta is missing the fields file names and
+// tags depend on: the metadata failed to parse, or it has no title.
+func NeedsFallback(meta *Meta, metaErr error) bool {
+	return metaErr != nil || meta == nil || strings.TrimSpace(meta.MusicName) == ""
+}
+
+// InferMeta fills the empty fields of meta from the source file name, using
+// the first pattern that matches. Fields that already have a value are kept.
+// It returns the names of the fields it filled ("title", "artist", "album",
+// "track").
+func InferMeta(meta *Meta, sourcePath string, patterns []*FallbackPattern) []string {
+	base := filepath.Base(sourcePath)
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	for _, fp := range patterns {
+		vals := fp.match(base)
+		if vals == nil {
+			continue
+		}
+		var filled []string
+		if v, ok := vals["title"]; ok && strings.TrimSpace(meta.MusicName) == "" {
+			meta.MusicName = v
+			filled = append(filled, "title")
+		}
+		if v, ok := vals["artist"]; ok && len(meta.ArtistNames()) == 0 {
+			meta.SetArtistNames(appendUnique(nil, artistListSplit.Split(v, -1)...))
+			filled = append(filled, "artist")
+		}
+		if v, ok := vals["album"]; ok && meta.Album == "" {
+			meta.Album = v
+			filled = append(filled, "album")
+		}
+		if v, ok := vals["track"]; ok && meta.Track == 0 {
+			if n, err := strconv.Atoi(v); err == nil && n > 0 {
+				meta.Track = n
+				filled = append(filled, "track")
+			}
+		}
+		return filled
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package ncm
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"PureNCM/internal/config"
+)
+
+func TestParseFallbackPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		wantErr bool
+	}{
+		{"{artist} - {title}", false},
+		{"{track}. {title} ({album})", false},
+		{"[{artist}] {title}", false},
+		{"{title}", false},
+		{"no placeholders", true},
+		{"{genre} - {title}", true},
+		{"{title} - {title}", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			fp, err := ParseFallbackPattern(tt.pattern)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && fp.String() != tt.pattern {
+				t.Errorf("String = %q", fp.String())
+			}
+		})
+	}
+}
+
+func TestInferMeta(t *testing.T) {
+	var defaults []*FallbackPattern
+	for _, p := range config.DefaultFallbackPatterns {
+		fp, err := ParseFallbackPattern(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defaults = append(defaults, fp)
+	}
+	custom, err := ParseFallbackPattern("{track}. {title} [{album}]")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		source      string
+		meta        *Meta
+		patterns    []*FallbackPattern
+		wantFilled  []string
+		wantTitle   string
+		wantArtists []string
+		wantAlbum   string
+		wantTrack   int
+	}{
+		{
+			name: "artist - title", source: "/music/Band - Song.ncm", meta: &Meta{}, patterns: defaults,
+			wantFilled: []string{"title", "artist"}, wantTitle: "Song", wantArtists: []string{"Band"},
+		},
+		{
+			name: "artist list", source: "A,B、C - Song.ncm", meta: &Meta{}, patterns: defaults,
+			wantFilled: []string{"title", "artist"}, wantTitle: "Song", wantArtists: []string{"A", "B", "C"},
+		},
+		{
+			name: "track number", source: "03. Song.ncm", meta: &Meta{}, patterns: defaults,
+			wantFilled: []string{"title", "track"}, wantTitle: "Song", wantTrack: 3,
+		},
+		{
+			name: "whitespace runs", source: "  07.   Song .ncm", meta: &Meta{}, patterns: defaults,
+			wantFilled: []string{"title", "track"}, wantTitle: "Song", wantTrack: 7,
+		},
+		{
+			name: "bare title", source: "Song.ncm", meta: &Meta{}, patterns: defaults,
+			wantFilled: []string{"title"}, wantTitle: "Song",
+		},
+		{
+			name: "existing fields kept", source: "Band - Song.ncm", meta: testMeta("", "", "Known"), patterns: defaults,
+			wantFilled: []string{"title"}, wantTitle: "Song", wantArtists: []string{"Known"},
+		},
+		{
+			name: "custom pattern", source: "12. Song [Album].ncm", meta: &Meta{}, patterns: []*FallbackPattern{custom},
+			wantFilled: []string{"title", "album", "track"}, wantTitle: "Song", wantAlbum: "Album", wantTrack: 12,
+		},
+		{
+			name: "no match", source: "Song.ncm", meta: &Meta{}, patterns: []*FallbackPattern{custom},
+		},
+		{
+			name: "track zero not used", source: "0. Song [Album].ncm", meta: &Meta{}, patterns: []*FallbackPattern{custom},
+			wantFilled: []string{"title", "album"}, wantTitle: "Song", wantAlbum: "Album",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filled := InferMeta(tt.meta, tt.source, tt.patterns)
+			if !reflect.DeepEqual(filled, tt.wantFilled) {
+				t.Errorf("filled = %v, want %v", filled, tt.wantFilled)
+			}
+			m := tt.meta
+			if m.MusicName != tt.wantTitle || m.Album != tt.wantAlbum || m.Track != tt.wantTrack {
+				t.Errorf("got %q / %q / %d, want %q / %q / %d",
+					m.MusicName, m.Album, m.Track, tt.wantTitle, tt.wantAlbum, tt.wantTrack)
+			}
+			if got := m.ArtistNames(); !reflect.DeepEqual(got, tt.wantArtists) && len(got)+len(tt.wantArtists) > 0 {
+				t.Errorf("artists = %q, want %q", got, tt.wantArtists)
+			}
+		})
+	}
+}
+
+func TestNeedsFallback(t *testing.T) {
+	tests := []struct {
+		name string
+		meta *Meta
+		err  error
+		want bool
+	}{
+		{"complete", testMeta("Song", "", "A"), nil, false},
+		{"no title", testMeta("  ", "Album", "A"), nil, true},
+		{"no metadata", nil, nil, true},
+		{"parse error", testMeta("Song", "", "A"), errors.New("bad json"), true},
+	}
+	for _, tt := range tests {
+		if got := NeedsFallback(tt.meta, tt.err); got != tt.want {
+			t.Errorf("%s: NeedsFallback = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package ncm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	id3v2 "github.com/bogem/id3v2/v2"
+	flacvorbis "github.com/go-flac/flacvorbis"
+
+	"PureNCM/internal/lyrics"
+)
+
+// lyricsLanguage is the ISO 639-2 code written to USLT/SYLT frames.
+// NCM metadata carries no language, so "und" (undetermined) is used.
+const lyricsLanguage = "und"
+
+// Vorbis comment fields for lyrics. LYRICS carries the timed LRC text
+// (read by foobar2000, Poweramp, etc.); UNSYNCEDLYRICS carries plain text.
+const (
+	vorbisLyrics         = "LYRICS"
+	vorbisUnsyncedLyrics = "UNSYNCEDLYRICS"
+)
+
+// syltFrame is an ID3v2 SYLT (synchronised lyrics) frame, which the
+// id3v2 package does not provide.
+//
+// Layout: encoding | language[3] | timestamp format | content type |
+// descriptor + terminator | { text + terminator | uint32 time }...
+type syltFrame struct {
+	Language   string
+	Descriptor string
+	Lines      []lyrics.Line
+}
+
+const (
+	syltTimestampMillis = 2 // absolute time in milliseconds
+	syltContentLyrics   = 1
+)
+
+func (f syltFrame) body() []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(id3v2.EncodingUTF8.Key)
+	buf.WriteString(f.Language)
+	buf.WriteByte(syltTimestampMillis)
+	buf.WriteByte(syltContentLyrics)
+	buf.WriteString(f.Descriptor)
+	buf.WriteByte(0)
+	for _, ln := range f.Lines {
+		buf.WriteString(ln.Text)
+		buf.WriteByte(0)
+		_ = binary.Write(&buf, binary.BigEndian, uint32(ln.Time.Milliseconds()))
+	}
+	return buf.Bytes()
+}
+
+func (f syltFrame) Size() int                { return len(f.body()) }
+func (f syltFrame) UniqueIdentifier() string { return f.Language + f.Descriptor }
+
+func (f syltFrame) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(f.body())
+	return int64(n), err
+}
+
+// addMp3Lyrics adds a USLT frame and, for timed lyrics, a SYLT frame.
+func addMp3Lyrics(tag *id3v2.Tag, lrc *lyrics.LRC) {
+	if lrc.IsEmpty() {
+		return
+	}
+	tag.AddUnsynchronisedLyricsFrame(id3v2.UnsynchronisedLyricsFrame{
+		Encoding:          id3v2.EncodingUTF8,
+		Language:          lyricsLanguage,
+		ContentDescriptor: "",
+		Lyrics:            lrc.Plain(),
+	})
+	if lrc.Synced() {
+		tag.AddFrame("SYLT", syltFrame{Language: lyricsLanguage, Lines: lrc.Lines})
+	}
+}
+
+// addFlacLyrics adds LYRICS / UNSYNCEDLYRICS Vorbis comments.
+func addFlacLyrics(cmt *flacvorbis.MetaDataBlockVorbisComment, lrc *lyrics.LRC) {
+	if lrc.IsEmpty() {
+		return
+	}
+	if lrc.Synced() {
+		_ = cmt.Add(vorbisLyrics, lrc.String())
+	} else {
+		_ = cmt.Add(vorbisLyrics, lrc.Plain())
+	}
+	_ = cmt.Add(vorbisUnsyncedLyrics, lrc.Plain())
+}
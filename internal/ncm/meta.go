@@ -1,22 +1,68 @@
 package ncm
 
-import "encoding/json"
+import (
+	"bytes"
+	"encoding/json"
+
+	"PureNCM/internal/chinese"
+)
+
+// ID is a NetEase database key. Its JSON type varies across NCM versions
+// (string vs number), so both are accepted and stored as a string.
+type ID string
+
+// UnmarshalJSON accepts a JSON string or number.
+func (id *ID) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*id = ID(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*id = ID(n.String())
+	return nil
+}
 
 // Meta holds the decoded song metadata from the NCM file's metadata block.
-// Note: musicId and albumId are intentionally omitted — they are internal
-// NetEase database keys with no use in conversion, and their JSON type
-// varies across NCM versions (string vs number), making them error-prone.
+// Note: albumId is intentionally omitted — it has no use in conversion.
 type Meta struct {
+	MusicID   ID       `json:"musicId"` // used to look up cached lyrics
 	MusicName string   `json:"musicName"`
 	Artist    [][2]any `json:"artist"` // [[name, id], ...]
 	Album     string   `json:"album"`
 	AlbumPic  string   `json:"albumPic"` // cover art URL
-	Bitrate   int      `json:"bitrate"`
-	Format    string   `json:"format"` // "mp3" or "flac"
+	Bitrate   int      `json:"bitrate"`  // bits per second
+	Duration  int      `json:"duration"` // milliseconds
+	Format    string   `json:"format"`   // "mp3" or "flac"
+
+	// AlbumArtist is not part of NCM metadata; it is filled in by enrichment.
+	AlbumArtist string `json:"-"`
+	// Track is the track number, when known from the file name or enrichment.
+	Track int `json:"-"`
+	// Disc and Year come from enrichment only; 0 = unknown.
+	Disc int `json:"-"`
+	Year int `json:"-"`
+	// MusicBrainz holds the identifiers of a confident MusicBrainz match.
+	MusicBrainz MusicBrainzIDs `json:"-"`
 }
 
-// Artists returns a comma-joined string of artist names.
-func (m *Meta) Artists() string {
+// MusicBrainzIDs are written to the tags Picard and beets read. Empty
+// fields are not written.
+type MusicBrainzIDs struct {
+	RecordingID    string
+	ReleaseID      string
+	ReleaseGroupID string
+	ArtistIDs      []string
+}
+
+// ArtistNames returns the artist names in order.
+func (m *Meta) ArtistNames() []string {
 	names := make([]string, 0, len(m.Artist))
 	for _, a := range m.Artist {
 		if len(a) > 0 {
@@ -25,8 +71,46 @@ func (m *Meta) Artists() string {
 			}
 		}
 	}
-	result := ""
+	return names
+}
+
+// SetArtistNames replaces the artists. IDs are kept by position when the
+// count is unchanged (a rename), otherwise by matching name.
+func (m *Meta) SetArtistNames(names []string) {
+	old := m.Artist
+	ids := map[string]any{}
+	for _, a := range old {
+		if name, ok := a[0].(string); ok {
+			ids[name] = a[1]
+		}
+	}
+	m.Artist = make([][2]any, len(names))
 	for i, n := range names {
+		m.Artist[i][0] = n
+		if len(old) == len(names) {
+			m.Artist[i][1] = old[i][1]
+		} else {
+			m.Artist[i][1] = ids[n]
+		}
+	}
+}
+
+// AlbumArtistName returns the album artist, falling back to the first artist
+// since NCM metadata usually carries none.
+func (m *Meta) AlbumArtistName() string {
+	if m.AlbumArtist != "" {
+		return m.AlbumArtist
+	}
+	if names := m.ArtistNames(); len(names) > 0 {
+		return names[0]
+	}
+	return ""
+}
+
+// Artists returns a "/"-joined string of artist names.
+func (m *Meta) Artists() string {
+	result := ""
+	for i, n := range m.ArtistNames() {
 		if i > 0 {
 			result += "/"
 		}
@@ -35,6 +119,22 @@ func (m *Meta) Artists() string {
 	return result
 }
 
+// ConvertScript converts the title, artists and album to another Chinese
+// script in place, so file names and tags agree. None is a no-op.
+func (m *Meta) ConvertScript(c chinese.Conversion) {
+	if c == chinese.None {
+		return
+	}
+	m.MusicName = chinese.Convert(m.MusicName, c)
+	m.Album = chinese.Convert(m.Album, c)
+	m.AlbumArtist = chinese.Convert(m.AlbumArtist, c)
+	for i, a := range m.Artist {
+		if name, ok := a[0].(string); ok {
+			m.Artist[i][0] = chinese.Convert(name, c)
+		}
+	}
+}
+
 // parseMeta decodes JSON metadata from the decrypted meta block.
 // The raw bytes start with "music:" prefix before the JSON payload.
 func parseMeta(raw []byte) (*Meta, error) {
@@ -0,0 +1,59 @@
+package ncm
+
+import (
+	"strings"
+
+	id3v2 "github.com/bogem/id3v2/v2"
+	flacvorbis "github.com/go-flac/flacvorbis"
+)
+
+// musicBrainzOwner is the UFID owner Picard uses for the recording ID.
+const musicBrainzOwner = "http://musicbrainz.org"
+
+// TXXX descriptions and Vorbis fields for MusicBrainz IDs, as written by Picard.
+const (
+	txxxReleaseID      = "MusicBrainz Album Id"
+	txxxReleaseGroupID = "MusicBrainz Release Group Id"
+	txxxArtistID       = "MusicBrainz Artist Id"
+
+	vorbisRecordingID    = "MUSICBRAINZ_TRACKID"
+	vorbisReleaseID      = "MUSICBRAINZ_ALBUMID"
+	vorbisReleaseGroupID = "MUSICBRAINZ_RELEASEGROUPID"
+	vorbisArtistID       = "MUSICBRAINZ_ARTISTID"
+)
+
+// addMp3MusicBrainz adds a UFID frame for the recording and TXXX frames for
+// the release, release group and artists.
+func addMp3MusicBrainz(tag *id3v2.Tag, ids MusicBrainzIDs) {
+	if ids.RecordingID != "" {
+		tag.AddUFIDFrame(id3v2.UFIDFrame{OwnerIdentifier: musicBrainzOwner, Identifier: []byte(ids.RecordingID)})
+	}
+	txxx := func(desc, value string) {
+		if value != "" {
+			tag.AddUserDefinedTextFrame(id3v2.UserDefinedTextFrame{
+				Encoding:    id3v2.EncodingUTF8,
+				Description: desc,
+				Value:       value,
+			})
+		}
+	}
+	txxx(txxxReleaseID, ids.ReleaseID)
+	txxx(txxxReleaseGroupID, ids.ReleaseGroupID)
+	// The tag is ID3v2.4, which separates multiple values with a null
+	txxx(txxxArtistID, strings.Join(ids.ArtistIDs, "\x00"))
+}
+
+// addFlacMusicBrainz adds MUSICBRAINZ_* Vorbis comments, one field per artist.
+func addFlacMusicBrainz(cmt *flacvorbis.MetaDataBlockVorbisComment, ids MusicBrainzIDs) {
+	add := func(field, value string) {
+		if value != "" {
+			_ = cmt.Add(field, value)
+		}
+	}
+	add(vorbisRecordingID, ids.RecordingID)
+	add(vorbisReleaseID, ids.ReleaseID)
+	add(vorbisReleaseGroupID, ids.ReleaseGroupID)
+	for _, id := range ids.ArtistIDs {
+		add(vorbisArtistID, id)
+	}
+}
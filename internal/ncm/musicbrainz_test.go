@@ -0,0 +1,50 @@
+package ncm
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	id3v2 "github.com/bogem/id3v2/v2"
+)
+
+func TestAddMp3MusicBrainz(t *testing.T) {
+	tag := id3v2.NewEmptyTag()
+	addMp3MusicBrainz(tag, MusicBrainzIDs{
+		RecordingID: "rec",
+		ReleaseID:   "rel",
+		ArtistIDs:   []string{"a1", "a2"},
+	})
+	var buf bytes.Buffer
+	if _, err := tag.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := id3v2.ParseReader(&buf, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Version() != 4 {
+		t.Fatalf("tag version = %d, want 4", read.Version())
+	}
+
+	got := map[string]string{}
+	for _, f := range read.GetFrames(read.CommonID("User defined text information frame")) {
+		udtf := f.(id3v2.UserDefinedTextFrame)
+		got[udtf.Description] = udtf.Value
+	}
+	want := map[string]string{
+		txxxReleaseID: "rel",
+		txxxArtistID:  "a1\x00a2",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("TXXX frames = %q, want %q", got, want)
+	}
+
+	ufids := read.GetFrames("UFID")
+	if len(ufids) != 1 {
+		t.Fatalf("%d UFID frames, want 1", len(ufids))
+	}
+	if u := ufids[0].(id3v2.UFIDFrame); u.OwnerIdentifier != musicBrainzOwner || string(u.Identifier) != "rec" {
+		t.Errorf("UFID = %+v", u)
+	}
+}
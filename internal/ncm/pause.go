@@ -0,0 +1,71 @@
+package ncm
+
+import (
+	"context"
+	"sync"
+)
+
+// PauseGate parks conversions at their next chunk boundary while it is
+// paused. The zero value is open; a nil *PauseGate never pauses.
+type PauseGate struct {
+	mu     sync.Mutex
+	resume chan struct{} // non-nil while paused, closed by Resume
+}
+
+// Pause closes the gate. Conversions carrying it stop at their next chunk.
+func (g *PauseGate) Pause() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resume == nil {
+		g.resume = make(chan struct{})
+	}
+}
+
+// Resume opens the gate and releases every parked conversion.
+func (g *PauseGate) Resume() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resume != nil {
+		close(g.resume)
+		g.resume = nil
+	}
+}
+
+// Paused reports whether the gate is closed.
+func (g *PauseGate) Paused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.resume != nil
+}
+
+// Wait blocks while the gate is paused. It returns ctx's error, so a
+// cancellation also releases a parked conversion.
+func (g *PauseGate) Wait(ctx context.Context) error {
+	if g != nil {
+		g.mu.Lock()
+		resume := g.resume
+		g.mu.Unlock()
+		if resume != nil {
+			select {
+			case <-resume:
+			case <-ctx.Done():
+			}
+		}
+	}
+	return ctx.Err()
+}
+
+type pauseGateKey struct{}
+
+// WithPauseGate returns a context whose conversions park at chunk
+// boundaries while g is paused.
+func WithPauseGate(ctx context.Context, g *PauseGate) context.Context {
+	return context.WithValue(ctx, pauseGateKey{}, g)
+}
+
+// checkpoint is called between chunks: it waits out a pause and returns
+// ctx's error when the conversion has been cancelled.
+func checkpoint(ctx context.Context) error {
+	g, _ := ctx.Value(pauseGateKey{}).(*PauseGate)
+	return g.Wait(ctx)
+}
@@ -0,0 +1,113 @@
+package ncm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPauseGateWait(t *testing.T) {
+	tests := []struct {
+		name    string
+		gate    *PauseGate
+		paused  bool
+		release func(g *PauseGate, cancel context.CancelFunc)
+		wantErr error
+	}{
+		{name: "nil gate", gate: nil},
+		{name: "open", gate: &PauseGate{}},
+		{
+			name: "resumed", gate: &PauseGate{}, paused: true,
+			release: func(g *PauseGate, _ context.CancelFunc) { g.Resume() },
+		},
+		{
+			name: "cancelled while paused", gate: &PauseGate{}, paused: true,
+			release: func(_ *PauseGate, cancel context.CancelFunc) { cancel() },
+			wantErr: context.Canceled,
+		},
+		{
+			name: "cancelled while open", gate: &PauseGate{},
+			release: func(_ *PauseGate, cancel context.CancelFunc) { cancel() },
+			wantErr: context.Canceled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.paused {
+				tt.gate.Pause()
+				tt.gate.Pause() // pausing twice is harmless
+				if !tt.gate.Paused() {
+					t.Fatal("gate not paused")
+				}
+			}
+			done := make(chan error, 1)
+			go func() { done <- checkpoint(WithPauseGate(ctx, tt.gate)) }()
+			if tt.paused {
+				select {
+				case err := <-done:
+					t.Fatalf("Wait returned %v while paused", err)
+				case <-time.After(30 * time.Millisecond):
+				}
+			}
+			if tt.release != nil {
+				tt.release(tt.gate, cancel)
+			}
+			select {
+			case err := <-done:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Wait = %v, want %v", err, tt.wantErr)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Wait did not return")
+			}
+			if tt.gate != nil {
+				tt.gate.Resume()
+				tt.gate.Resume() // resuming an open gate is harmless
+				if tt.gate.Paused() {
+					t.Error("gate still paused")
+				}
+			}
+		})
+	}
+	if err := checkpoint(context.Background()); err != nil {
+		t.Errorf("checkpoint without a gate = %v", err)
+	}
+}
+
+func TestPauseDuringWrite(t *testing.T) {
+	var g PauseGate
+	ctx := WithPauseGate(context.Background(), &g)
+	data := bytes.Repeat([]byte{1}, progressChunk*3)
+	var chunks atomic.Int32
+	var buf bytes.Buffer
+	done := make(chan error, 1)
+	go func() {
+		done <- writeChunks(ctx, &buf, data, StageWriting, func(StageProgress) {
+			if chunks.Add(1) == 1 {
+				g.Pause() // park before the second chunk
+			}
+		})
+	}()
+
+	time.Sleep(30 * time.Millisecond)
+	if n := chunks.Load(); n != 1 {
+		t.Fatalf("%d chunks written while paused, want 1", n)
+	}
+	g.Resume()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("write did not resume")
+	}
+	if chunks.Load() != 3 || !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("%d chunks, %d bytes after resuming", chunks.Load(), buf.Len())
+	}
+}
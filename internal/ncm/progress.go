@@ -0,0 +1,118 @@
+package ncm
+
+import (
+	"context"
+	"io"
+)
+
+// Stage is one step of converting a file.
+type Stage string
+
+const (
+	StageReading       Stage = "reading"       // reading the NCM file
+	StageDecrypting    Stage = "decrypting"    // RC4 over the audio
+	StageFetchingCover Stage = "fetchingCover" // downloading cover art
+	StageTagging       Stage = "tagging"       // building tags, parsing FLAC metadata
+	StageWriting       Stage = "writing"       // writing the output file
+	StageVerifying     Stage = "verifying"     // checking the written file
+)
+
+// stageOrder lists the stages in pipeline order with their share of the
+// overall progress, roughly by the time each takes on a local disk.
+var stageOrder = []struct {
+	stage  Stage
+	weight float64
+}{
+	{StageReading, 0.20},
+	{StageDecrypting, 0.20},
+	{StageFetchingCover, 0.05},
+	{StageTagging, 0.05},
+	{StageWriting, 0.40},
+	{StageVerifying, 0.10},
+}
+
+// StageProgress reports progress within one stage. Done and Total are
+// bytes for the reading, decrypting, writing and verifying stages; stages
+// without a byte count report 0/1 and 1/1.
+type StageProgress struct {
+	Stage Stage
+	Done  int64
+	Total int64
+}
+
+// Fraction returns the progress within the stage, 0..1.
+func (p StageProgress) Fraction() float64 {
+	if p.Total <= 0 {
+		return 0
+	}
+	return min(float64(p.Done)/float64(p.Total), 1)
+}
+
+// Overall returns the progress of the whole conversion, 0..1, counting
+// earlier stages as complete. Skipped stages (e.g. no cover to fetch)
+// therefore show as a jump, never as going backwards.
+func (p StageProgress) Overall() float64 {
+	var sum float64
+	for _, s := range stageOrder {
+		if s.stage == p.Stage {
+			return sum + s.weight*p.Fraction()
+		}
+		sum += s.weight
+	}
+	return sum
+}
+
+// ProgressFunc receives stage progress. Implementations must be cheap; it
+// is called for every chunk read or written.
+type ProgressFunc func(StageProgress)
+
+// report calls fn when it is set.
+func (fn ProgressFunc) report(stage Stage, done, total int64) {
+	if fn != nil {
+		fn(StageProgress{Stage: stage, Done: done, Total: total})
+	}
+}
+
+// progressChunk is the unit in which byte stages report progress.
+const progressChunk = 256 << 10
+
+// countingReader reports the bytes read through it, pausing and stopping
+// with ctx (see checkpoint).
+type countingReader struct {
+	ctx   context.Context
+	r     io.Reader
+	stage Stage
+	total int64
+	done  int64
+	fn    ProgressFunc
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	if err := checkpoint(cr.ctx); err != nil {
+		return 0, err
+	}
+	n, err := cr.r.Read(p)
+	if n > 0 {
+		cr.done += int64(n)
+		cr.fn.report(cr.stage, cr.done, cr.total)
+	}
+	return n, err
+}
+
+// writeChunks writes data to w in progressChunk pieces, reporting each and
+// passing a checkpoint in between. io.Copy from a bytes.Reader would hand
+// over everything in one Write.
+func writeChunks(ctx context.Context, w io.Writer, data []byte, stage Stage, fn ProgressFunc) error {
+	total := int64(len(data))
+	for off := 0; off < len(data); off += progressChunk {
+		if err := checkpoint(ctx); err != nil {
+			return err
+		}
+		end := min(off+progressChunk, len(data))
+		if _, err := w.Write(data[off:end]); err != nil {
+			return err
+		}
+		fn.report(stage, int64(end), total)
+	}
+	return nil
+}
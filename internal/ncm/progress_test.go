@@ -0,0 +1,69 @@
+package ncm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestStageProgress(t *testing.T) {
+	tests := []struct {
+		p            StageProgress
+		wantFraction float64
+		wantOverall  float64
+	}{
+		{StageProgress{StageReading, 0, 100}, 0, 0},
+		{StageProgress{StageReading, 50, 100}, 0.5, 0.10},
+		{StageProgress{StageDecrypting, 100, 100}, 1, 0.40},
+		{StageProgress{StageFetchingCover, 0, 1}, 0, 0.40},
+		{StageProgress{StageFetchingCover, 1, 1}, 1, 0.45},
+		{StageProgress{StageTagging, 1, 1}, 1, 0.50},
+		{StageProgress{StageWriting, 150, 100}, 1, 0.90},
+		{StageProgress{StageVerifying, 1, 2}, 0.5, 0.95},
+		{StageProgress{StageVerifying, 5, 0}, 0, 0.90},
+		{StageProgress{"unknown", 1, 1}, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.p.Stage), func(t *testing.T) {
+			if got := tt.p.Fraction(); math.Abs(got-tt.wantFraction) > 1e-9 {
+				t.Errorf("%+v Fraction = %v, want %v", tt.p, got, tt.wantFraction)
+			}
+			if got := tt.p.Overall(); math.Abs(got-tt.wantOverall) > 1e-9 {
+				t.Errorf("%+v Overall = %v, want %v", tt.p, got, tt.wantOverall)
+			}
+		})
+	}
+}
+
+func TestWriteChunks(t *testing.T) {
+	data := bytes.Repeat([]byte{1}, progressChunk*2+10)
+	var reports []StageProgress
+	var buf bytes.Buffer
+	err := writeChunks(context.Background(), &buf, data, StageWriting, func(p StageProgress) {
+		reports = append(reports, p)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Error("data not written as given")
+	}
+	want := []int64{progressChunk, progressChunk * 2, int64(len(data))}
+	if len(reports) != len(want) {
+		t.Fatalf("%d reports, want %d", len(reports), len(want))
+	}
+	for i, p := range reports {
+		if p.Stage != StageWriting || p.Done != want[i] || p.Total != int64(len(data)) {
+			t.Errorf("report %d = %+v", i, p)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	buf.Reset()
+	if err := writeChunks(ctx, &buf, data, StageWriting, nil); !errors.Is(err, context.Canceled) || buf.Len() != 0 {
+		t.Errorf("cancelled write: %v after %d bytes", err, buf.Len())
+	}
+}
@@ -0,0 +1,130 @@
+package ncm
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Reservations tracks the output paths claimed by pending writes, so that
+// concurrent writers never target the same file. Paths are compared
+// case-insensitively, as on Windows and macOS filesystems, so "Song.mp3" and
+// "song.MP3" are treated as the same file on every platform. Under
+// CollisionReplaceIfBetter the extension is ignored too, as that policy
+// treats "Song.flac" and "Song.mp3" as copies of one track.
+//
+// Duplicates are resolved by appending " (2)", " (3)", ... in the order
+// Reserve is called; callers that need stable names across runs should
+// reserve in input order before starting workers.
+type Reservations struct {
+	mu      sync.Mutex
+	owners  map[string]string // folded key → owner
+	byOwner map[string]held   // owner → its reservation
+}
+
+// held is a reservation with the key it is stored under, which depends on
+// the policy it was made with.
+type held struct {
+	Reservation
+	key string
+}
+
+// Reservation is the output path held by one owner.
+type Reservation struct {
+	Requested string `json:"requested"` // the path asked for
+	Path      string `json:"path"`      // Requested or its " (n)" variant
+}
+
+// NewReservations returns an empty reservation table.
+func NewReservations() *Reservations {
+	return &Reservations{owners: map[string]string{}, byOwner: map[string]held{}}
+}
+
+// Reserve claims path for owner and returns the path actually reserved: path
+// itself, or the first "name (n).ext" variant not held by another owner.
+// Reserving the same path again for the same owner returns the same result;
+// reserving a different one, e.g. after the metadata changed, releases the
+// old reservation. With CollisionRename, variants that already exist on disk
+// are skipped as well.
+func (r *Reservations) Reserve(path, owner string, policy CollisionPolicy) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if got, ok := r.byOwner[owner]; ok {
+		if foldPath(got.Requested) == foldPath(path) {
+			return got.Path
+		}
+		r.release(owner)
+	}
+
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for n := 1; ; n++ {
+		candidate := path
+		if n > 1 {
+			candidate = fmt.Sprintf("%s (%d)%s", base, n, ext)
+		}
+		key := reservationKey(candidate, policy)
+		if _, taken := r.owners[key]; taken {
+			continue
+		}
+		if policy == CollisionRename && exists(candidate) {
+			continue
+		}
+		r.owners[key] = owner
+		r.byOwner[owner] = held{Reservation{Requested: path, Path: candidate}, key}
+		return candidate
+	}
+}
+
+// Restore records res for owner as it was reserved before, e.g. by a
+// session being resumed, without checking the disk. A later Reserve of
+// res.Requested by owner returns res.Path.
+func (r *Reservations) Restore(owner string, res Reservation, policy CollisionPolicy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.release(owner)
+	key := reservationKey(res.Path, policy)
+	r.owners[key] = owner
+	r.byOwner[owner] = held{res, key}
+}
+
+// Lookup returns the reservation held by owner, if any.
+func (r *Reservations) Lookup(owner string) (Reservation, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h, ok := r.byOwner[owner]
+	return h.Reservation, ok
+}
+
+// Release drops owner's reservation, if any, once its output is no longer
+// being written, so that later writers may claim the path.
+func (r *Reservations) Release(owner string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.release(owner)
+}
+
+// release drops owner's reservation. The caller holds r.mu.
+func (r *Reservations) release(owner string) {
+	if h, ok := r.byOwner[owner]; ok {
+		if r.owners[h.key] == owner {
+			delete(r.owners, h.key)
+		}
+		delete(r.byOwner, owner)
+	}
+}
+
+// reservationKey returns the key path is reserved under for policy.
+func reservationKey(path string, policy CollisionPolicy) string {
+	if policy == CollisionReplaceIfBetter {
+		path = strings.TrimSuffix(path, filepath.Ext(path))
+	}
+	return foldPath(path)
+}
+
+// foldPath normalises a path for case-insensitive comparison.
+func foldPath(p string) string {
+	return strings.ToLower(filepath.Clean(p))
+}
@@ -0,0 +1,143 @@
+package ncm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestReserve(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Taken.mp3"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	type call struct{ path, owner, want string }
+	tests := []struct {
+		name   string
+		policy CollisionPolicy
+		calls  []call
+	}{
+		{"distinct names", CollisionOverwrite, []call{
+			{"A.mp3", "1", "A.mp3"},
+			{"B.mp3", "2", "B.mp3"},
+		}},
+		{"duplicates numbered in call order", CollisionOverwrite, []call{
+			{"Song.mp3", "1", "Song.mp3"},
+			{"Song.mp3", "2", "Song (2).mp3"},
+			{"Song.mp3", "3", "Song (3).mp3"},
+		}},
+		{"case-insensitive", CollisionOverwrite, []call{
+			{"Song.mp3", "1", "Song.mp3"},
+			{"song.MP3", "2", "song (2).MP3"},
+		}},
+		{"same owner keeps its path", CollisionOverwrite, []call{
+			{"Song.mp3", "1", "Song.mp3"},
+			{"Song.mp3", "2", "Song (2).mp3"},
+			{"Song.mp3", "2", "Song (2).mp3"},
+		}},
+		{"changed path releases the old one", CollisionOverwrite, []call{
+			{"Song.mp3", "1", "Song.mp3"},
+			{"Other.mp3", "1", "Other.mp3"},
+			{"Song.mp3", "2", "Song.mp3"},
+		}},
+		{"extensions differ", CollisionOverwrite, []call{
+			{"Song.flac", "1", "Song.flac"},
+			{"Song.mp3", "2", "Song.mp3"},
+		}},
+		{"replace if better ignores the extension", CollisionReplaceIfBetter, []call{
+			{"Song.flac", "1", "Song.flac"},
+			{"Song.mp3", "2", "Song (2).mp3"},
+		}},
+		{"rename skips files on disk", CollisionRename, []call{
+			{"Taken.mp3", "1", "Taken (2).mp3"},
+		}},
+		{"overwrite ignores files on disk", CollisionOverwrite, []call{
+			{"Taken.mp3", "1", "Taken.mp3"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReservations()
+			for _, c := range tt.calls {
+				got := r.Reserve(filepath.Join(dir, c.path), c.owner, tt.policy)
+				if want := filepath.Join(dir, c.want); got != want {
+					t.Errorf("Reserve(%q, %q) = %q, want %q", c.path, c.owner, filepath.Base(got), c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestReserveConcurrent(t *testing.T) {
+	const owners = 64
+	for _, policy := range []CollisionPolicy{CollisionOverwrite, CollisionReplaceIfBetter} {
+		t.Run(string(policy), func(t *testing.T) {
+			r := NewReservations()
+			got := make([]string, owners)
+			var wg sync.WaitGroup
+			for i := range owners {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					// Alternate the case and extension of one name
+					path := "out/Song.mp3"
+					if i%2 == 1 {
+						path = "OUT/song.flac"
+					}
+					owner := fmt.Sprint(i)
+					got[i] = r.Reserve(path, owner, policy)
+					if again := r.Reserve(path, owner, policy); again != got[i] {
+						t.Errorf("owner %d: second Reserve = %q, first %q", i, again, got[i])
+					}
+				}()
+			}
+			wg.Wait()
+
+			seen := map[string]int{}
+			for i, p := range got {
+				key := reservationKey(p, policy)
+				if prev, dup := seen[key]; dup {
+					t.Errorf("owners %d and %d both reserved %q", prev, i, p)
+				}
+				seen[key] = i
+				if res, ok := r.Lookup(fmt.Sprint(i)); !ok || res.Path != p {
+					t.Errorf("Lookup(%d) = %+v, %v; want %q", i, res, ok, p)
+				}
+				if !strings.Contains(strings.ToLower(p), "song") {
+					t.Errorf("owner %d reserved %q", i, p)
+				}
+			}
+		})
+	}
+}
+
+func TestReserveRelease(t *testing.T) {
+	r := NewReservations()
+	for _, policy := range []CollisionPolicy{CollisionOverwrite, CollisionReplaceIfBetter} {
+		if got := r.Reserve("Song.mp3", "1", policy); got != "Song.mp3" {
+			t.Fatalf("%s: Reserve = %q", policy, got)
+		}
+		r.Release("1")
+		r.Release("1") // releasing twice is harmless
+		if _, ok := r.Lookup("1"); ok {
+			t.Errorf("%s: released reservation still held", policy)
+		}
+		if got := r.Reserve("Song.mp3", "2", policy); got != "Song.mp3" {
+			t.Errorf("%s: Reserve after release = %q, want Song.mp3", policy, got)
+		}
+		r.Release("2")
+	}
+
+	// A restored reservation is released under the key it was restored with
+	r.Restore("1", Reservation{Requested: "Song.mp3", Path: "Song (2).mp3"}, CollisionReplaceIfBetter)
+	if got := r.Reserve("Song (2).flac", "2", CollisionReplaceIfBetter); got != "Song (2) (2).flac" {
+		t.Errorf("Reserve over a restored reservation = %q", got)
+	}
+	r.Release("1")
+	if got := r.Reserve("Song (2).mp3", "3", CollisionReplaceIfBetter); got != "Song (2).mp3" {
+		t.Errorf("Reserve after releasing a restored reservation = %q", got)
+	}
+}
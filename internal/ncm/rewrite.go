@@ -0,0 +1,192 @@
+package ncm
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+	"golang.org/x/text/width"
+)
+
+// RewriteField selects which metadata field a rewrite rule applies to.
+type RewriteField string
+
+const (
+	FieldTitle  RewriteField = "title"
+	FieldArtist RewriteField = "artist" // each artist name separately
+	FieldAlbum  RewriteField = "album"
+	FieldAll    RewriteField = "all" // title, every artist and album
+)
+
+// RewriteAction is what a rewrite rule does to the field.
+type RewriteAction string
+
+const (
+	ActionReplace   RewriteAction = "replace"   // regex find / replace; $1 refers to groups
+	ActionTrim      RewriteAction = "trim"      // trim and collapse whitespace
+	ActionNFC       RewriteAction = "nfc"       // Unicode NFC normalisation
+	ActionHalfWidth RewriteAction = "halfwidth" // full-width letters, digits and symbols to ASCII
+	// ActionMoveFeat moves "feat. X" out of the title into the artist list
+	// (FieldTitle), or splits "A feat. B" artist names (FieldArtist).
+	ActionMoveFeat RewriteAction = "moveFeat"
+)
+
+// RewriteRule is one step of metadata cleanup. Only ActionReplace uses
+// Pattern and Replace.
+type RewriteRule struct {
+	Field   RewriteField
+	Action  RewriteAction
+	Pattern string
+	Replace string
+}
+
+// Rewriter applies an ordered list of rewrite rules to metadata.
+type Rewriter struct {
+	rules []compiledRule
+}
+
+type compiledRule struct {
+	RewriteRule
+	re *regexp.Regexp
+}
+
+// NewRewriter validates and compiles rules. Errors name the rule by its
+// 1-based position, since they are shown in the settings page.
+func NewRewriter(rules []RewriteRule) (*Rewriter, error) {
+	rw := &Rewriter{}
+	for i, r := range rules {
+		switch r.Field {
+		case FieldTitle, FieldArtist, FieldAlbum, FieldAll:
+		default:
+			return nil, fmt.Errorf("第 %d 条规则：未知字段 %q", i+1, r.Field)
+		}
+		c := compiledRule{RewriteRule: r}
+		switch r.Action {
+		case ActionReplace:
+			if r.Pattern == "" {
+				return nil, fmt.Errorf("第 %d 条规则：正则表达式为空", i+1)
+			}
+			re, err := regexp.Compile(r.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("第 %d 条规则：正则表达式无效：%v", i+1, err)
+			}
+			c.re = re
+		case ActionTrim, ActionNFC, ActionHalfWidth:
+		case ActionMoveFeat:
+			if r.Field != FieldTitle && r.Field != FieldArtist {
+				return nil, fmt.Errorf("第 %d 条规则：移动 feat. 只能用于标题或歌手", i+1)
+			}
+		default:
+			return nil, fmt.Errorf("第 %d 条规则：未知操作 %q", i+1, r.Action)
+		}
+		rw.rules = append(rw.rules, c)
+	}
+	return rw, nil
+}
+
+// Apply rewrites m in place, rule by rule. A nil Rewriter does nothing.
+func (rw *Rewriter) Apply(m *Meta) {
+	if rw == nil {
+		return
+	}
+	for _, r := range rw.rules {
+		if r.Action == ActionMoveFeat {
+			if r.Field == FieldTitle {
+				moveFeatFromTitle(m)
+			} else {
+				splitFeatArtists(m)
+			}
+			continue
+		}
+		if r.Field == FieldTitle || r.Field == FieldAll {
+			m.MusicName = r.apply(m.MusicName)
+		}
+		if r.Field == FieldAlbum || r.Field == FieldAll {
+			m.Album = r.apply(m.Album)
+		}
+		if r.Field == FieldArtist || r.Field == FieldAll {
+			names := m.ArtistNames()
+			for i := range names {
+				names[i] = r.apply(names[i])
+			}
+			m.SetArtistNames(names)
+		}
+	}
+}
+
+func (r compiledRule) apply(s string) string {
+	switch r.Action {
+	case ActionReplace:
+		return r.re.ReplaceAllString(s, r.Replace)
+	case ActionTrim:
+		return strings.Join(strings.Fields(s), " ")
+	case ActionNFC:
+		return norm.NFC.String(s)
+	case ActionHalfWidth:
+		// Fold maps full-width ASCII to narrow; the ideographic space is
+		// not covered by it
+		return strings.ReplaceAll(width.Fold.String(s), "　", " ")
+	}
+	return s
+}
+
+// featPattern matches a title followed by a trailing "feat. X" credit,
+// either in (), [], （） or 【】, or after a space or dash. Without a
+// bracket the bare word "feat" needs its dot, so "Heroic Feat of Arms" is
+// left alone.
+var featPattern = regexp.MustCompile(`(?i)^(.*?\S)(?:\s*[(\[（【]\s*(?:feat\.?|ft\.|featuring)|\s+(?:[-–—]\s*)?(?:feat\.|ft\.|featuring))\s+([^)\]）】]+?)\s*[)\]）】]?\s*$`)
+
+// featSplit separates the names in a feat. credit.
+var featSplit = regexp.MustCompile(`(?i)\s*(?:,|，|、|&|/|\band\b|\bx\b)\s*`)
+
+// moveFeatFromTitle moves "Song (feat. A & B)" credits into the artists.
+func moveFeatFromTitle(m *Meta) {
+	match := featPattern.FindStringSubmatch(m.MusicName)
+	if match == nil {
+		return
+	}
+	title := strings.TrimSpace(match[1])
+	if title == "" {
+		return
+	}
+	m.MusicName = title
+	m.SetArtistNames(appendUnique(m.ArtistNames(), featSplit.Split(match[2], -1)...))
+}
+
+// artistFeat matches "A feat. B" in an artist name.
+var artistFeat = regexp.MustCompile(`(?i)\s+(?:feat\.?|ft\.|featuring)\s+`)
+
+// splitFeatArtists splits "A feat. B" artist names into separate artists.
+func splitFeatArtists(m *Meta) {
+	var names []string
+	for _, n := range m.ArtistNames() {
+		parts := artistFeat.Split(n, 2)
+		names = appendUnique(names, parts[0])
+		if len(parts) > 1 {
+			names = appendUnique(names, featSplit.Split(parts[1], -1)...)
+		}
+	}
+	m.SetArtistNames(names)
+}
+
+// appendUnique appends the non-empty names not already in list (case-insensitive).
+func appendUnique(list []string, names ...string) []string {
+	for _, n := range names {
+		n = strings.TrimSpace(n)
+		if n == "" {
+			continue
+		}
+		dup := false
+		for _, have := range list {
+			if strings.EqualFold(have, n) {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			list = append(list, n)
+		}
+	}
+	return list
+}
@@ -0,0 +1,128 @@
+package ncm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMoveFeatFromTitle(t *testing.T) {
+	tests := []struct {
+		title       string
+		wantTitle   string
+		wantArtists []string
+	}{
+		{"Song (feat. Guest)", "Song", []string{"Main", "Guest"}},
+		{"Song [ft. A & B]", "Song", []string{"Main", "A", "B"}},
+		{"Song（feat. 客人）", "Song", []string{"Main", "客人"}},
+		{"Song 【Featuring A、B】", "Song", []string{"Main", "A", "B"}},
+		{"Song feat. Guest", "Song", []string{"Main", "Guest"}},
+		{"Song - ft. Guest", "Song", []string{"Main", "Guest"}},
+		{"Song (feat Guest)", "Song", []string{"Main", "Guest"}},
+		{"Song (feat. main)", "Song", []string{"Main"}},
+		// No title before the credit, or no bracket or separator
+		{"Feat of Strength", "Feat of Strength", []string{"Main"}},
+		{"feat. Guest", "feat. Guest", []string{"Main"}},
+		{"(feat. Guest)", "(feat. Guest)", []string{"Main"}},
+		{"Heroic Feat of Arms", "Heroic Feat of Arms", []string{"Main"}},
+		{"Defeat. Someone", "Defeat. Someone", []string{"Main"}},
+		{"Song", "Song", []string{"Main"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			m := testMeta(tt.title, "", "Main")
+			moveFeatFromTitle(m)
+			if m.MusicName != tt.wantTitle {
+				t.Errorf("title = %q, want %q", m.MusicName, tt.wantTitle)
+			}
+			if got := m.ArtistNames(); !reflect.DeepEqual(got, tt.wantArtists) {
+				t.Errorf("artists = %q, want %q", got, tt.wantArtists)
+			}
+		})
+	}
+}
+
+func TestRewriterApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []RewriteRule
+		in    *Meta
+		want  *Meta
+	}{
+		{
+			name:  "replace with groups",
+			rules: []RewriteRule{{Field: FieldTitle, Action: ActionReplace, Pattern: `^(.*) \(Live\)$`, Replace: "$1 [Live]"}},
+			in:    testMeta("Song (Live)", "Album (Live)", "Band"),
+			want:  testMeta("Song [Live]", "Album (Live)", "Band"),
+		},
+		{
+			name:  "trim every field",
+			rules: []RewriteRule{{Field: FieldAll, Action: ActionTrim}},
+			in:    testMeta("  Song   Title ", " Album ", " Band  A "),
+			want:  testMeta("Song Title", "Album", "Band A"),
+		},
+		{
+			name:  "half width",
+			rules: []RewriteRule{{Field: FieldAlbum, Action: ActionHalfWidth}},
+			in:    testMeta("Ｓｏｎｇ", "ＡＢＣ　１２３", "Band"),
+			want:  testMeta("Ｓｏｎｇ", "ABC 123", "Band"),
+		},
+		{
+			name:  "nfc",
+			rules: []RewriteRule{{Field: FieldArtist, Action: ActionNFC}},
+			in:    testMeta("Song", "", "Beyonce\u0301"),
+			want:  testMeta("Song", "", "Beyonc\u00e9"),
+		},
+		{
+			name:  "split artist credits",
+			rules: []RewriteRule{{Field: FieldArtist, Action: ActionMoveFeat}},
+			in:    testMeta("Song", "", "A feat. B, C", "C"),
+			want:  testMeta("Song", "", "A", "B", "C"),
+		},
+		{
+			name: "rules run in order",
+			rules: []RewriteRule{
+				{Field: FieldTitle, Action: ActionMoveFeat},
+				{Field: FieldTitle, Action: ActionReplace, Pattern: `Song`, Replace: "Tune"},
+			},
+			in:   testMeta("Song (feat. B)", "", "A"),
+			want: testMeta("Tune", "", "A", "B"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw, err := NewRewriter(tt.rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rw.Apply(tt.in)
+			if tt.in.MusicName != tt.want.MusicName || tt.in.Album != tt.want.Album ||
+				!reflect.DeepEqual(tt.in.ArtistNames(), tt.want.ArtistNames()) {
+				t.Errorf("got %q / %q / %q, want %q / %q / %q",
+					tt.in.MusicName, tt.in.Album, tt.in.ArtistNames(),
+					tt.want.MusicName, tt.want.Album, tt.want.ArtistNames())
+			}
+		})
+	}
+	var nilRewriter *Rewriter
+	nilRewriter.Apply(testMeta("Song", "", "A")) // must not panic
+}
+
+func TestNewRewriterErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		rule RewriteRule
+	}{
+		{"unknown field", RewriteRule{Field: "genre", Action: ActionTrim}},
+		{"unknown action", RewriteRule{Field: FieldTitle, Action: "upper"}},
+		{"empty pattern", RewriteRule{Field: FieldTitle, Action: ActionReplace}},
+		{"bad pattern", RewriteRule{Field: FieldTitle, Action: ActionReplace, Pattern: "("}},
+		{"feat on album", RewriteRule{Field: FieldAlbum, Action: ActionMoveFeat}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewRewriter([]RewriteRule{{Field: FieldAll, Action: ActionTrim}, tt.rule}); err == nil {
+				t.Error("rule accepted")
+			}
+		})
+	}
+}
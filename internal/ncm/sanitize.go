@@ -0,0 +1,175 @@
+package ncm
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SanitizeTarget selects the filesystem rules a file name must satisfy.
+type SanitizeTarget string
+
+const (
+	// TargetWindows follows NTFS: no \/:*?"<>| or control characters, no
+	// trailing dots or spaces, no reserved device names (CON, NUL, COM1...).
+	TargetWindows SanitizeTarget = "windows"
+	// TargetPOSIX only forbids "/" and control characters.
+	TargetPOSIX SanitizeTarget = "posix"
+	// TargetFAT32 is TargetWindows plus DEL, for FAT32/exFAT USB drives and
+	// car stereos whose firmware is stricter than Windows itself.
+	TargetFAT32 SanitizeTarget = "fat32"
+	// TargetStrict is TargetFAT32 plus characters that trouble shells, URLs
+	// and sync tools: #%&{}$!'@+=;` and leading "-".
+	TargetStrict SanitizeTarget = "strict"
+)
+
+// DefaultMaxNameBytes is the longest name, in UTF-8 bytes, most filesystems
+// accept (255 on ext4, APFS, NTFS and exFAT for ASCII names).
+const DefaultMaxNameBytes = 255
+
+// SanitizeOptions controls how names produced from metadata are made safe.
+// The zero value sanitises for Windows with a 255-byte limit.
+type SanitizeOptions struct {
+	Target   SanitizeTarget
+	MaxBytes int // per file or directory name, including extension; 0 = DefaultMaxNameBytes
+	// Replacements maps an illegal character to its substitute, e.g.
+	// ':' → "：". Illegal characters without an entry are deleted.
+	Replacements map[rune]string
+	// Transliterate converts names to ASCII first (pinyin, romaji, accent
+	// folding) for players that cannot display CJK; see Transliterate.
+	Transliterate bool
+}
+
+// FullWidthReplacements substitutes the characters Windows forbids with
+// their full-width look-alikes, so "AC/DC: Live?" stays readable.
+var FullWidthReplacements = map[rune]string{
+	'\\': "＼", '/': "／", ':': "：", '*': "＊", '?': "？",
+	'"': "＂", '<': "＜", '>': "＞", '|': "｜",
+}
+
+// windowsReserved are device names Windows refuses as a file name stem.
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+func (o SanitizeOptions) maxBytes() int {
+	if o.MaxBytes <= 0 {
+		return DefaultMaxNameBytes
+	}
+	return o.MaxBytes
+}
+
+func (o SanitizeOptions) windowsRules() bool {
+	return o.Target != TargetPOSIX
+}
+
+// illegal reports whether r may not appear in a name for the target.
+func (o SanitizeOptions) illegal(r rune) bool {
+	if r < 0x20 || r == utf8.RuneError {
+		return true
+	}
+	switch o.Target {
+	case TargetPOSIX:
+		return r == '/'
+	case TargetStrict:
+		if strings.ContainsRune("#%&{}$!'@+=;`", r) {
+			return true
+		}
+		fallthrough
+	case TargetFAT32:
+		if r == 0x7f {
+			return true
+		}
+	}
+	return strings.ContainsRune(`\/:*?"<>|`, r)
+}
+
+// Name sanitises a single file or directory name: illegal characters are
+// replaced or deleted, whitespace is trimmed, reserved names are escaped and
+// the result is truncated to MaxBytes. It may return "".
+func (o SanitizeOptions) Name(name string) string {
+	return o.fit(o.clean(name), "")
+}
+
+// FileName is Name for a file whose extension (e.g. ".mp3") must survive
+// truncation.
+func (o SanitizeOptions) FileName(stem, ext string) string {
+	stem = o.fit(o.clean(stem), ext)
+	if stem == "" {
+		return ""
+	}
+	return stem + ext
+}
+
+// clean transliterates name when enabled, then applies cleanChars.
+func (o SanitizeOptions) clean(name string) string {
+	return o.cleanChars(o.transliterate(name))
+}
+
+// transliterate converts name to ASCII when Transliterate is set.
+func (o SanitizeOptions) transliterate(name string) string {
+	if o.Transliterate {
+		return Transliterate(name)
+	}
+	return name
+}
+
+// cleanChars replaces illegal characters and applies the target's naming rules.
+func (o SanitizeOptions) cleanChars(name string) string {
+	var sb strings.Builder
+	for _, r := range name {
+		if !o.illegal(r) {
+			sb.WriteRune(r)
+			continue
+		}
+		if rep, ok := o.Replacements[r]; ok {
+			// Replacements are user input: drop anything illegal in them too
+			for _, rr := range rep {
+				if !o.illegal(rr) {
+					sb.WriteRune(rr)
+				}
+			}
+		}
+	}
+	s := strings.TrimSpace(sb.String())
+	if o.Target == TargetStrict {
+		s = strings.Join(strings.Fields(s), " ")
+		s = strings.TrimLeft(s, "-")
+	}
+	if o.windowsRules() {
+		s = strings.TrimRight(s, ". ")
+		stem, _, _ := strings.Cut(s, ".")
+		if windowsReserved[strings.ToUpper(strings.TrimSpace(stem))] {
+			s = stem + "_" + s[len(stem):]
+		}
+	}
+	return s
+}
+
+// fit truncates name at a rune boundary so that name+ext fits in MaxBytes,
+// then re-applies the trailing dot and space rule.
+func (o SanitizeOptions) fit(name, ext string) string {
+	limit := o.maxBytes() - len(ext)
+	if limit <= 0 {
+		return ""
+	}
+	if len(name) > limit {
+		cut := 0
+		for i := range name {
+			if i > limit {
+				break
+			}
+			cut = i
+		}
+		name = name[:cut]
+		name = strings.TrimRightFunc(name, unicode.IsSpace)
+		if o.windowsRules() {
+			name = strings.TrimRight(name, ". ")
+		}
+	}
+	return name
+}
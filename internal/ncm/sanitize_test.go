@@ -0,0 +1,71 @@
+package ncm
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		name string
+		opts SanitizeOptions
+		in   string
+		want string
+	}{
+		{"windows illegal removed", SanitizeOptions{}, `AC/DC: "Live"?`, "ACDC Live"},
+		{"control characters", SanitizeOptions{}, "a\tb\x00c", "abc"},
+		{"trailing dots and spaces", SanitizeOptions{}, "Song... ", "Song"},
+		{"reserved name", SanitizeOptions{}, "con", "con_"},
+		{"reserved name with extension", SanitizeOptions{}, "NUL.txt", "NUL_.txt"},
+		{"reserved name with spaces", SanitizeOptions{}, "COM1 .tar", "COM1 _.tar"},
+		{"not reserved", SanitizeOptions{}, "CONSOLE", "CONSOLE"},
+		{"full-width replacements", SanitizeOptions{Replacements: FullWidthReplacements}, "AC/DC: Live?", "AC／DC： Live？"},
+		{"illegal replacement dropped", SanitizeOptions{Replacements: map[rune]string{':': "/-"}}, "a:b", "a-b"},
+		{"posix keeps windows characters", SanitizeOptions{Target: TargetPOSIX}, `What? a:b "c"`, `What? a:b "c"`},
+		{"posix removes slash", SanitizeOptions{Target: TargetPOSIX}, "AC/DC", "ACDC"},
+		{"posix keeps trailing dot and reserved names", SanitizeOptions{Target: TargetPOSIX}, "CON.", "CON."},
+		{"fat32 removes DEL", SanitizeOptions{Target: TargetFAT32}, "a\x7fb", "ab"},
+		{"windows keeps DEL", SanitizeOptions{}, "a\x7fb", "a\x7fb"},
+		{"strict", SanitizeOptions{Target: TargetStrict}, "--Rock & Roll #1  (50%)!", "Rock Roll 1 (50)"},
+		{"invalid UTF-8", SanitizeOptions{}, "a\xffb", "ab"},
+		{"only illegal", SanitizeOptions{}, "???", ""},
+		{"truncated at a rune boundary", SanitizeOptions{MaxBytes: 7}, "歌曲名字", "歌曲"},
+		{"truncation trims the cut", SanitizeOptions{MaxBytes: 6}, "ab cd.ef", "ab cd"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.opts.Name(tt.in); got != tt.want {
+				t.Errorf("Name(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeFileName(t *testing.T) {
+	long := strings.Repeat("歌", 100) // 300 bytes
+	tests := []struct {
+		name string
+		opts SanitizeOptions
+		stem string
+		ext  string
+		want string
+	}{
+		{"plain", SanitizeOptions{}, "Song", ".mp3", "Song.mp3"},
+		{"empty stem", SanitizeOptions{}, "?", ".mp3", ""},
+		{"extension kept when truncating", SanitizeOptions{MaxBytes: 10}, "abcdefghij", ".flac", "abcde.flac"},
+		{"limit smaller than the extension", SanitizeOptions{MaxBytes: 3}, "abc", ".mp3", ""},
+		{"default limit", SanitizeOptions{}, long, ".mp3", strings.Repeat("歌", 83) + ".mp3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.opts.FileName(tt.stem, tt.ext)
+			if got != tt.want {
+				t.Errorf("FileName(%q, %q) = %q, want %q", tt.stem, tt.ext, got, tt.want)
+			}
+			if len(got) > tt.opts.maxBytes() || !utf8.ValidString(got) {
+				t.Errorf("FileName = %q, %d bytes", got, len(got))
+			}
+		})
+	}
+}
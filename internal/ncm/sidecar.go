@@ -0,0 +1,95 @@
+package ncm
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// CoverSidecarOptions controls writing the cover image next to the output file
+// (cover.jpg / folder.jpg) for media servers that prefer it over embedded art.
+type CoverSidecarOptions struct {
+	Filename  string // e.g. "cover.jpg"; empty disables the sidecar
+	Overwrite bool   // replace an existing sidecar instead of keeping it
+	NoEmbed   bool   // write only the sidecar, do not embed the cover in the audio
+}
+
+// sidecarLocks serialises sidecar writes per destination path, so concurrent
+// workers converting tracks of the same album do not race on the same file.
+var sidecarLocks sync.Map // map[string]*sync.Mutex
+
+func lockPath(path string) func() {
+	v, _ := sidecarLocks.LoadOrStore(strings.ToLower(path), &sync.Mutex{})
+	m := v.(*sync.Mutex)
+	m.Lock()
+	return m.Unlock
+}
+
+// writeCoverSidecar writes cover into dir under opts.Filename, made safe by
+// sanitize. A .jpg or .jpeg name always gets a JPEG, re-encoding other
+// formats; any other name gets the extension of the image format instead.
+// It reports whether the file was written (false when an existing one was
+// kept).
+func writeCoverSidecar(dir string, cover []byte, opts CoverSidecarOptions, sanitize SanitizeOptions) (bool, error) {
+	stem, ext := opts.Filename, filepath.Ext(opts.Filename)
+	if imageExts[strings.ToLower(ext)] {
+		stem = strings.TrimSuffix(stem, ext)
+	} else {
+		ext = ""
+	}
+	mime := detectCover(cover).MimeType
+	if e := strings.ToLower(ext); e == ".jpg" || e == ".jpeg" {
+		if mime != "image/jpeg" {
+			img, _, err := image.Decode(bytes.NewReader(cover))
+			if err != nil {
+				return false, fmt.Errorf("cover sidecar: %w", err)
+			}
+			if cover, err = encodeJPEG(img, DefaultCoverJPEGQuality); err != nil {
+				return false, fmt.Errorf("cover sidecar: %w", err)
+			}
+		}
+	} else {
+		ext = imageExt(mime)
+	}
+	name := sanitize.FileName(stem, ext)
+	if name == "" {
+		return false, fmt.Errorf("cover sidecar: invalid file name %q", opts.Filename)
+	}
+	path := filepath.Join(dir, name)
+
+	unlock := lockPath(path)
+	defer unlock()
+
+	if !opts.Overwrite {
+		if _, err := os.Stat(path); err == nil {
+			return false, nil
+		}
+	}
+
+	// Write via a temp file so readers never see a half-written image
+	if err := WriteFileAtomic(path, cover); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// imageExts are the extensions replaced to match the cover's format.
+var imageExts = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true}
+
+// imageExt returns the file extension for an image MIME type.
+func imageExt(mime string) string {
+	switch mime {
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	default:
+		return ".jpg"
+	}
+}
@@ -0,0 +1,102 @@
+package ncm
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestWriteCoverSidecar(t *testing.T) {
+	pngCover := encodeImage(t, "png", testImage(4, 4))
+	jpegCover := encodeImage(t, "jpeg", testImage(4, 4))
+	posix := SanitizeOptions{Target: TargetPOSIX}
+	tests := []struct {
+		name        string
+		existing    string // name of a sidecar already present
+		cover       []byte
+		opts        CoverSidecarOptions
+		sanitize    SanitizeOptions
+		wantName    string
+		wantMime    string
+		wantWritten bool
+	}{
+		{"new", "", jpegCover, CoverSidecarOptions{Filename: "cover.jpg"}, SanitizeOptions{}, "cover.jpg", "image/jpeg", true},
+		{"extension from the image", "", pngCover, CoverSidecarOptions{Filename: "folder"}, SanitizeOptions{}, "folder.png", "image/png", true},
+		{"png converted for a .jpg name", "", pngCover, CoverSidecarOptions{Filename: "cover.jpg"}, SanitizeOptions{}, "cover.jpg", "image/jpeg", true},
+		{"png converted for a .JPEG name", "", pngCover, CoverSidecarOptions{Filename: "Folder.JPEG"}, SanitizeOptions{}, "Folder.JPEG", "image/jpeg", true},
+		{"png name matched to a jpeg", "", jpegCover, CoverSidecarOptions{Filename: "cover.png"}, SanitizeOptions{}, "cover.jpg", "image/jpeg", true},
+		{"other extension kept in the stem", "", pngCover, CoverSidecarOptions{Filename: "cover.v2"}, SanitizeOptions{}, "cover.v2.png", "image/png", true},
+		{"existing kept", "cover.jpg", jpegCover, CoverSidecarOptions{Filename: "cover.jpg"}, SanitizeOptions{}, "cover.jpg", "", false},
+		{"existing overwritten", "cover.jpg", jpegCover, CoverSidecarOptions{Filename: "cover.jpg", Overwrite: true}, SanitizeOptions{}, "cover.jpg", "image/jpeg", true},
+		{"name sanitised", "", jpegCover, CoverSidecarOptions{Filename: "../cover?.jpg"}, SanitizeOptions{}, "..cover.jpg", "image/jpeg", true},
+		{"name sanitised for the target", "", jpegCover, CoverSidecarOptions{Filename: "cover?.jpg"}, posix, "cover?.jpg", "image/jpeg", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.existing != "" {
+				if err := os.WriteFile(filepath.Join(dir, tt.existing), []byte("old"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			written, err := writeCoverSidecar(dir, tt.cover, tt.opts, tt.sanitize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if written != tt.wantWritten {
+				t.Errorf("written = %v, want %v", written, tt.wantWritten)
+			}
+			data, err := os.ReadFile(filepath.Join(dir, tt.wantName))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.wantWritten {
+				if string(data) != "old" {
+					t.Error("existing sidecar replaced")
+				}
+				return
+			}
+			if got := detectCover(data); got.MimeType != tt.wantMime || got.Width != 4 {
+				t.Errorf("sidecar is %+v, want a 4px %s", got, tt.wantMime)
+			}
+		})
+	}
+}
+
+func TestWriteCoverSidecarEmptyName(t *testing.T) {
+	cover := encodeImage(t, "jpeg", testImage(4, 4))
+	if _, err := writeCoverSidecar(t.TempDir(), cover, CoverSidecarOptions{Filename: "???.jpg"}, SanitizeOptions{}); err == nil {
+		t.Error("name with nothing left after sanitising accepted")
+	}
+}
+
+func TestWriteCoverSidecarConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	cover := encodeImage(t, "jpeg", testImage(4, 4))
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	writes := 0
+	for range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			written, err := writeCoverSidecar(dir, cover, CoverSidecarOptions{Filename: "cover.jpg"}, SanitizeOptions{})
+			if err != nil {
+				t.Error(err)
+			}
+			if written {
+				mu.Lock()
+				writes++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if writes != 1 {
+		t.Errorf("sidecar written %d times, want once", writes)
+	}
+	if left := tempFiles(t, dir); len(left) > 0 {
+		t.Errorf("temp files left: %v", left)
+	}
+}
@@ -0,0 +1,59 @@
+package ncm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteToFileContextCancel(t *testing.T) {
+	audio := bytes.Repeat(mp3Frame(0xFB, 0x90), progressChunk/8) // several write chunks
+	tests := []struct {
+		name       string
+		cancelAt   Stage // cancel on the first report of this stage; "" = never
+		preCancel  bool
+		wantErr    error
+		wantOutput bool
+	}{
+		{name: "complete", wantOutput: true},
+		{name: "cancelled before starting", preCancel: true, wantErr: context.Canceled},
+		{name: "cancelled while tagging", cancelAt: StageTagging, wantErr: context.Canceled},
+		{name: "cancelled while writing", cancelAt: StageWriting, wantErr: context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.preCancel {
+				cancel()
+			}
+			result := &DecryptResult{Meta: testMeta("Song", "Album", "Band"), Audio: audio, Format: "mp3"}
+			out, err := WriteToFileContext(ctx, result, dir, WriteOptions{
+				FilenamePattern: "{artist} - {title}",
+				Report: func(p StageProgress) {
+					if p.Stage == tt.cancelAt {
+						cancel()
+					}
+				},
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			want := filepath.Join(dir, "Band - Song.mp3")
+			_, statErr := os.Stat(want)
+			if exists := statErr == nil; exists != tt.wantOutput {
+				t.Errorf("output exists = %v, want %v", exists, tt.wantOutput)
+			}
+			if tt.wantOutput && out != want {
+				t.Errorf("output = %q, want %q", out, want)
+			}
+			if left := tempFiles(t, dir); len(left) > 0 {
+				t.Errorf("partial files left: %v", left)
+			}
+		})
+	}
+}
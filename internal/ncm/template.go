@@ -0,0 +1,364 @@
+package ncm
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultFilenamePattern is used when a pattern is empty or invalid.
+const DefaultFilenamePattern = "{title}"
+
+// Filename templates
+//
+// A template is literal text with placeholders:
+//
+//	{title} {artist} {first_artist} {album} {album_artist}
+//	{bitrate} {format} {music_id} {duration} {source_name} {index}
+//
+// {name:N} truncates the value to N characters; for {index} it zero-pads to
+// N digits instead. A section in square brackets, e.g. "[{album}/]", is only
+// rendered when every placeholder inside it has a value. "/" (or "\") splits
+// the result into subdirectories, e.g. "{artist}/{album}/{title}".
+// Separators inside values never create directories; like other illegal
+// characters they are replaced or removed per SanitizeOptions.
+
+// placeholders lists the names accepted in templates.
+var placeholders = map[string]bool{
+	"title": true, "artist": true, "first_artist": true, "album": true,
+	"album_artist": true, "bitrate": true, "format": true, "music_id": true,
+	"duration": true, "source_name": true, "index": true,
+}
+
+// TemplateData is the input for rendering a filename template.
+type TemplateData struct {
+	Meta       *Meta
+	Format     string // "mp3" or "flac"
+	SourcePath string // path of the .ncm file
+	Index      int    // 1-based position in the batch; 0 = unknown
+	Total      int    // batch size, used to pad {index}
+	// Sanitize controls how path segments are made safe for the filesystem.
+	Sanitize SanitizeOptions
+}
+
+// Template is a parsed filename template.
+type Template struct {
+	pattern string
+	nodes   []tmplNode
+}
+
+type tmplNodeKind int
+
+const (
+	nodeText tmplNodeKind = iota
+	nodePlaceholder
+	nodeSection
+	nodeSeparator
+)
+
+type tmplNode struct {
+	kind     tmplNodeKind
+	text     string     // nodeText: literal; nodePlaceholder: name
+	width    int        // nodePlaceholder: ":N" argument, 0 = none
+	children []tmplNode // nodeSection
+}
+
+// TemplateError describes an invalid filename template.
+type TemplateError struct {
+	Pos int // character (rune) offset in the pattern
+	Msg string
+}
+
+func (e *TemplateError) Error() string {
+	return fmt.Sprintf("文件名格式错误（第 %d 个字符）：%s", e.Pos+1, e.Msg)
+}
+
+// ParseTemplate parses and validates a filename template.
+func ParseTemplate(pattern string) (*Template, error) {
+	p := &tmplParser{src: pattern}
+	nodes, err := p.parse(false)
+	if err != nil {
+		return nil, err
+	}
+	return &Template{pattern: pattern, nodes: nodes}, nil
+}
+
+// MustParseTemplate parses pattern, falling back to DefaultFilenamePattern
+// when it is empty or invalid.
+func MustParseTemplate(pattern string) *Template {
+	if t, err := ParseTemplate(pattern); err == nil && strings.TrimSpace(pattern) != "" {
+		return t
+	}
+	t, _ := ParseTemplate(DefaultFilenamePattern)
+	return t
+}
+
+// String returns the source pattern.
+func (t *Template) String() string { return t.pattern }
+
+type tmplParser struct {
+	src string
+	pos int
+}
+
+func (p *tmplParser) errorf(pos int, format string, args ...any) error {
+	return &TemplateError{Pos: utf8.RuneCountInString(p.src[:pos]), Msg: fmt.Sprintf(format, args...)}
+}
+
+// parse reads nodes until the end of input, or until "]" when inSection.
+func (p *tmplParser) parse(inSection bool) ([]tmplNode, error) {
+	var nodes []tmplNode
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			nodes = append(nodes, tmplNode{kind: nodeText, text: text.String()})
+			text.Reset()
+		}
+	}
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch c {
+		case '{':
+			flush()
+			n, err := p.placeholder()
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, n)
+		case '}':
+			return nil, p.errorf(p.pos, "多余的 “}”")
+		case '[':
+			flush()
+			open := p.pos
+			p.pos++
+			children, err := p.parse(true)
+			if err != nil {
+				return nil, err
+			}
+			if !hasPlaceholder(children) {
+				return nil, p.errorf(open, "可选段 “[...]” 中没有占位符")
+			}
+			nodes = append(nodes, tmplNode{kind: nodeSection, children: children})
+		case ']':
+			if !inSection {
+				return nil, p.errorf(p.pos, "多余的 “]”")
+			}
+			flush()
+			p.pos++
+			return nodes, nil
+		case '/', '\\':
+			flush()
+			nodes = append(nodes, tmplNode{kind: nodeSeparator})
+			p.pos++
+		default:
+			_, size := utf8.DecodeRuneInString(p.src[p.pos:])
+			text.WriteString(p.src[p.pos : p.pos+size])
+			p.pos += size
+		}
+	}
+	if inSection {
+		return nil, p.errorf(start-1, "可选段缺少 “]”")
+	}
+	flush()
+	return nodes, nil
+}
+
+// placeholder parses "{name}" or "{name:N}" starting at the "{".
+func (p *tmplParser) placeholder() (tmplNode, error) {
+	open := p.pos
+	end := strings.IndexByte(p.src[open:], '}')
+	if end < 0 {
+		return tmplNode{}, p.errorf(open, "占位符缺少 “}”")
+	}
+	body := p.src[open+1 : open+end]
+	p.pos = open + end + 1
+
+	name, arg, hasArg := strings.Cut(body, ":")
+	name = strings.TrimSpace(name)
+	if !placeholders[name] {
+		return tmplNode{}, p.errorf(open, "未知占位符 {%s}", name)
+	}
+	n := tmplNode{kind: nodePlaceholder, text: name}
+	if hasArg {
+		w, err := strconv.Atoi(strings.TrimSpace(arg))
+		if err != nil || w <= 0 {
+			return tmplNode{}, p.errorf(open, "{%s} 的长度必须是正整数", body)
+		}
+		n.width = w
+	}
+	return n, nil
+}
+
+func hasPlaceholder(nodes []tmplNode) bool {
+	for _, n := range nodes {
+		if n.kind == nodePlaceholder || (n.kind == nodeSection && hasPlaceholder(n.children)) {
+			return true
+		}
+	}
+	return false
+}
+
+// pathSep marks a template separator while rendering; it cannot occur in
+// values because control characters are removed from them.
+const pathSep = '\x00'
+
+// RenderReport describes what rendering had to adjust, for previews.
+type RenderReport struct {
+	Empty     []string // placeholders outside "[...]" that had no value
+	Sanitized bool     // illegal characters were replaced or removed
+	TooLong   bool     // a name was truncated to the byte limit
+}
+
+// Render expands the template and returns a relative path using the OS
+// separator, without extension. Each path segment is sanitized per
+// d.Sanitize, leaving room for the ".format" extension in the last one;
+// empty segments are dropped. The result is "" when nothing usable remains.
+func (t *Template) Render(d TemplateData) string {
+	out, _ := t.RenderWithReport(d)
+	return out
+}
+
+// RenderWithReport is Render, also reporting empty placeholders, removed
+// characters and over-long names.
+func (t *Template) RenderWithReport(d TemplateData) (string, RenderReport) {
+	r := &renderer{data: d}
+	raw, _ := r.render(t.nodes, false)
+	o := d.Sanitize
+	parts := strings.Split(raw, string(pathSep))
+	var segs []string
+	for i, seg := range parts {
+		// Transliteration is asked for, so only what follows it is reported
+		seg = o.transliterate(seg)
+		clean := o.cleanChars(seg)
+		if clean != strings.TrimSpace(seg) {
+			r.report.Sanitized = true
+		}
+		ext := ""
+		if i == len(parts)-1 && d.Format != "" {
+			ext = "." + d.Format
+		}
+		if fitted := o.fit(clean, ext); fitted != clean {
+			r.report.TooLong = true
+			clean = fitted
+		}
+		if clean == "" || clean == "." || clean == ".." {
+			continue
+		}
+		segs = append(segs, clean)
+	}
+	return filepath.Join(segs...), r.report
+}
+
+type renderer struct {
+	data   TemplateData
+	report RenderReport
+}
+
+// render renders nodes and reports whether every placeholder had a value.
+func (r *renderer) render(nodes []tmplNode, inSection bool) (string, bool) {
+	var sb strings.Builder
+	complete := true
+	for _, n := range nodes {
+		switch n.kind {
+		case nodeText:
+			sb.WriteString(n.text)
+		case nodeSeparator:
+			sb.WriteRune(pathSep)
+		case nodePlaceholder:
+			raw := placeholderValue(n, r.data)
+			v := cleanValue(raw, n)
+			if v == "" {
+				complete = false
+				if !inSection {
+					r.report.Empty = append(r.report.Empty, n.text)
+				}
+			}
+			sb.WriteString(v)
+		case nodeSection:
+			if s, ok := r.render(n.children, true); ok {
+				sb.WriteString(s)
+			}
+		}
+	}
+	return sb.String(), complete
+}
+
+// placeholderValue returns the raw value for a placeholder node.
+func placeholderValue(n tmplNode, d TemplateData) string {
+	m := d.Meta
+	if m == nil {
+		m = &Meta{}
+	}
+	switch n.text {
+	case "title":
+		return m.MusicName
+	case "artist":
+		return strings.Join(m.ArtistNames(), ", ")
+	case "first_artist":
+		if names := m.ArtistNames(); len(names) > 0 {
+			return names[0]
+		}
+	case "album":
+		return m.Album
+	case "album_artist":
+		return m.AlbumArtistName()
+	case "bitrate":
+		if m.Bitrate > 0 {
+			return strconv.Itoa(m.Bitrate / 1000)
+		}
+	case "format":
+		if d.Format != "" {
+			return d.Format
+		}
+		return m.Format
+	case "music_id":
+		return string(m.MusicID)
+	case "duration":
+		if m.Duration > 0 {
+			secs := m.Duration / 1000
+			return fmt.Sprintf("%dm%02ds", secs/60, secs%60)
+		}
+	case "source_name":
+		if d.SourcePath != "" {
+			base := filepath.Base(d.SourcePath)
+			return strings.TrimSuffix(base, filepath.Ext(base))
+		}
+	case "index":
+		if d.Index > 0 {
+			width := n.width
+			if width == 0 {
+				width = len(strconv.Itoa(d.Total))
+			}
+			return fmt.Sprintf("%0*d", width, d.Index)
+		}
+	}
+	return ""
+}
+
+// cleanValue removes control characters from a placeholder value and applies
+// its width. {index} is already padded. Path separators are left to the
+// sanitizer, which replaces or removes them, so values never create
+// directories.
+func cleanValue(v string, n tmplNode) string {
+	if n.text == "index" {
+		return v
+	}
+	v = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, v)
+	return strings.TrimSpace(truncateRunes(strings.TrimSpace(v), n.width))
+}
+
+// truncateRunes shortens s to at most n runes; n <= 0 means no limit.
+func truncateRunes(s string, n int) string {
+	if n > 0 && utf8.RuneCountInString(s) > n {
+		return string([]rune(s)[:n])
+	}
+	return s
+}
@@ -0,0 +1,196 @@
+package ncm
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func testMeta(title, album string, artists ...string) *Meta {
+	m := &Meta{MusicName: title, Album: album}
+	m.SetArtistNames(artists)
+	return m
+}
+
+func TestRenderWithReport(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		meta    *Meta
+		opts    SanitizeOptions
+		want    string
+		report  RenderReport
+	}{
+		{
+			name:    "clean",
+			pattern: "{artist} - {title}",
+			meta:    testMeta("Song", "Album", "Band"),
+			want:    "Band - Song",
+		},
+		{
+			name:    "illegal characters removed",
+			pattern: "{title}",
+			meta:    testMeta("What?", "", "Band"),
+			want:    "What",
+			report:  RenderReport{Sanitized: true},
+		},
+		{
+			name:    "illegal characters replaced",
+			pattern: "{artist}",
+			meta:    testMeta("Song", "", "AC/DC"),
+			opts:    SanitizeOptions{Replacements: FullWidthReplacements},
+			want:    "AC／DC",
+			report:  RenderReport{Sanitized: true},
+		},
+		{
+			name:    "transliteration alone is not sanitising",
+			pattern: "{artist} - {title}",
+			meta:    testMeta("晴天", "", "周杰伦"),
+			opts:    SanitizeOptions{Transliterate: true},
+			want:    "Zhou Jie Lun - Qing Tian",
+		},
+		{
+			name:    "transliterated names still report illegal characters",
+			pattern: "{title}",
+			meta:    testMeta("晴天?", "", "周杰伦"),
+			opts:    SanitizeOptions{Transliterate: true},
+			want:    "Qing Tian",
+			report:  RenderReport{Sanitized: true},
+		},
+		{
+			name:    "empty placeholder",
+			pattern: "{album}/{title}",
+			meta:    testMeta("Song", "", "Band"),
+			want:    "Song",
+			report:  RenderReport{Empty: []string{"album"}},
+		},
+		{
+			name:    "empty placeholder in a section is not reported",
+			pattern: "[{album}/]{title}",
+			meta:    testMeta("Song", "", "Band"),
+			want:    "Song",
+		},
+		{
+			name:    "too long",
+			pattern: "{title}",
+			meta:    testMeta("abcdefghij", "", "Band"),
+			opts:    SanitizeOptions{MaxBytes: 8},
+			want:    "abcd",
+			report:  RenderReport{TooLong: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseTemplate(tt.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, report := tmpl.RenderWithReport(TemplateData{Meta: tt.meta, Format: "mp3", Sanitize: tt.opts})
+			if want := filepath.FromSlash(tt.want); got != want {
+				t.Errorf("Render = %q, want %q", got, want)
+			}
+			if !reflect.DeepEqual(report, tt.report) {
+				t.Errorf("report = %+v, want %+v", report, tt.report)
+			}
+		})
+	}
+}
+
+func TestParseTemplate(t *testing.T) {
+	tests := []struct {
+		pattern string
+		wantPos int // -1 = valid
+	}{
+		{"{title}", -1},
+		{"{artist}/{album}/{index:2} {title}", -1},
+		{"[{album}/]{title}", -1},
+		{"[[{album} - ]{year}]", 13},
+		{"[{album}[ ({bitrate})]/]{title}", -1},
+		{"{ title }", -1},
+		{"歌曲 {title", 3},
+		{"{title}}", 7},
+		{"{genre}", 0},
+		{"{title:0}", 0},
+		{"{title:x}", 0},
+		{"{index:-2}", 0},
+		{"[{title}", 0},
+		{"{title}]", 7},
+		{"[text]{title}", 0},
+		{"歌曲]", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			tmpl, err := ParseTemplate(tt.pattern)
+			if tt.wantPos < 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if tmpl.String() != tt.pattern {
+					t.Errorf("String = %q", tmpl.String())
+				}
+				return
+			}
+			var te *TemplateError
+			if !errors.As(err, &te) {
+				t.Fatalf("error = %v, want a TemplateError", err)
+			}
+			if te.Pos != tt.wantPos {
+				t.Errorf("error at %d, want %d: %v", te.Pos, tt.wantPos, err)
+			}
+		})
+	}
+}
+
+func TestMustParseTemplate(t *testing.T) {
+	for _, pattern := range []string{"", "  ", "{nope}", "{title"} {
+		if got := MustParseTemplate(pattern).String(); got != DefaultFilenamePattern {
+			t.Errorf("MustParseTemplate(%q) = %q, want the default", pattern, got)
+		}
+	}
+	if got := MustParseTemplate("{album}").String(); got != "{album}" {
+		t.Errorf("valid pattern replaced by %q", got)
+	}
+}
+
+func TestRender(t *testing.T) {
+	meta := testMeta("Song", "Album", "A", "B")
+	meta.MusicID = "1234"
+	meta.Bitrate = 320000
+	meta.Duration = 245000
+	tests := []struct {
+		pattern string
+		data    TemplateData
+		want    string
+	}{
+		{"{artist} - {title}", TemplateData{Meta: meta}, "A, B - Song"},
+		{"{first_artist}/{album}/{title}", TemplateData{Meta: meta}, "A/Album/Song"},
+		{"{album_artist}", TemplateData{Meta: meta}, "A"},
+		{"{title} [{bitrate}k] {format}", TemplateData{Meta: meta, Format: "mp3"}, "Song 320k mp3"},
+		{"{music_id} {duration}", TemplateData{Meta: meta}, "1234 4m05s"},
+		{"{source_name}", TemplateData{Meta: meta, SourcePath: filepath.Join("in", "Raw Name.ncm")}, "Raw Name"},
+		{"{index} {title}", TemplateData{Meta: meta, Index: 7, Total: 120}, "007 Song"},
+		{"{index:2} {title}", TemplateData{Meta: meta, Index: 7, Total: 120}, "07 Song"},
+		{"[{index}. ]{title}", TemplateData{Meta: meta}, "Song"},
+		{"{title:2}", TemplateData{Meta: testMeta("歌曲名字", "", "A")}, "歌曲"},
+		{"[{album} - ]{title}", TemplateData{Meta: testMeta("Song", "", "A")}, "Song"},
+		{"[{album}[ ({music_id})]/]{title}", TemplateData{Meta: meta}, "Album (1234)/Song"},
+		{"[{album}[ ({music_id})]/]{title}", TemplateData{Meta: testMeta("Song", "Album", "A")}, "Album/Song"},
+		{"{album}/{title}", TemplateData{Meta: testMeta("Song", "", "A")}, "Song"},
+		{"{artist}/{title}", TemplateData{Meta: testMeta("Song", "", "AC/DC")}, "ACDC/Song"},
+		{"{title}", TemplateData{Meta: testMeta("Line\nbreak", "", "A")}, "Linebreak"},
+		{"../{title}", TemplateData{Meta: meta}, "Song"},
+		{"{title}", TemplateData{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			tmpl, err := ParseTemplate(tt.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := tmpl.Render(tt.data), filepath.FromSlash(tt.want); got != want {
+				t.Errorf("Render = %q, want %q", got, want)
+			}
+		})
+	}
+}
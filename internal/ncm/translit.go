@@ -0,0 +1,214 @@
+package ncm
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/mozillazg/go-pinyin"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Transliterate converts s to printable ASCII for devices that cannot display
+// CJK file names: Chinese characters become capitalised pinyin syllables
+// ("周杰伦" → "Zhou Jie Lun"), kana becomes Hepburn romaji ("ありがとう" →
+// "arigatou") and other letters are folded to their ASCII base ("Beyoncé" →
+// "Beyonce"). Characters with no ASCII form are dropped. The pinyin table is
+// compiled into the binary, so no network access is needed.
+//
+// Japanese kanji are read as Chinese; there is no offline kanji dictionary.
+func Transliterate(s string) string {
+	var sb strings.Builder
+	runes := []rune(s)
+	// word tracks whether the last output was a transliterated syllable, so
+	// neighbouring words are separated by a space
+	word := false
+	space := func() {
+		if sb.Len() > 0 && !strings.HasSuffix(sb.String(), " ") {
+			sb.WriteByte(' ')
+		}
+	}
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r < 0x80:
+			if word && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+				space()
+			}
+			sb.WriteRune(r)
+			word = false
+		case unicode.Is(unicode.Han, r):
+			if py := pinyin.SinglePinyin(r, pinyinArgs); len(py) > 0 && py[0] != "" {
+				if sb.Len() > 0 && (word || isASCIIAlnum(lastByte(&sb))) {
+					space()
+				}
+				sb.WriteString(capitalize(py[0]))
+				word = true
+			}
+		case isKana(r):
+			j := i
+			for j < len(runes) && (isKana(runes[j]) || runes[j] == 'ー') {
+				j++
+			}
+			if sb.Len() > 0 && (word || isASCIIAlnum(lastByte(&sb))) {
+				space()
+			}
+			sb.WriteString(kanaToRomaji(runes[i:j]))
+			word = true
+			i = j - 1
+		default:
+			if f := foldRune(r); f != "" {
+				if word {
+					space()
+				}
+				sb.WriteString(f)
+				word = false
+			}
+		}
+	}
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
+
+var pinyinArgs = pinyin.Args{Style: pinyin.Normal, Fallback: func(rune, pinyin.Args) []string { return nil }}
+
+func lastByte(sb *strings.Builder) byte {
+	s := sb.String()
+	if s == "" {
+		return 0
+	}
+	return s[len(s)-1]
+}
+
+func isASCIIAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// foldSpecial covers letters that do not decompose into an ASCII base.
+var foldSpecial = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'Æ': "AE", 'œ': "oe", 'Œ': "OE", 'ø': "o", 'Ø': "O",
+	'đ': "d", 'Đ': "D", 'ð': "d", 'Ð': "D", 'þ': "th", 'Þ': "TH", 'ł': "l", 'Ł': "L",
+	'ı': "i", 'ħ': "h", 'Ħ': "H",
+	'“': "\"", '”': "\"", '‘': "'", '’': "'", '–': "-", '—': "-", '…': "...",
+	'、': ",", '。': ".", '「': "[", '」': "]", '『': "[", '』': "]", '【': "[", '】': "]",
+	'《': "<", '》': ">", '·': " ", '・': " ", '　': " ",
+}
+
+// foldRune returns the ASCII form of r, or "" when it has none.
+func foldRune(r rune) string {
+	if s, ok := foldSpecial[r]; ok {
+		return s
+	}
+	// NFKD splits accents off ("é" → "e" + U+0301) and maps full-width forms
+	// to ASCII ("Ａ" → "A"); keep whatever ASCII remains.
+	var sb strings.Builder
+	for _, c := range norm.NFKD.String(string(r)) {
+		if c < 0x80 {
+			sb.WriteRune(c)
+		}
+	}
+	return sb.String()
+}
+
+// isKana reports whether r is hiragana or katakana (excluding the long mark).
+func isKana(r rune) bool {
+	return r >= 0x3041 && r <= 0x3096 || r >= 0x30A1 && r <= 0x30FA
+}
+
+// kanaRomaji maps hiragana to Hepburn romaji. Katakana is looked up through
+// its hiragana counterpart.
+var kanaRomaji = map[rune]string{
+	'あ': "a", 'い': "i", 'う': "u", 'え': "e", 'お': "o",
+	'か': "ka", 'き': "ki", 'く': "ku", 'け': "ke", 'こ': "ko",
+	'が': "ga", 'ぎ': "gi", 'ぐ': "gu", 'げ': "ge", 'ご': "go",
+	'さ': "sa", 'し': "shi", 'す': "su", 'せ': "se", 'そ': "so",
+	'ざ': "za", 'じ': "ji", 'ず': "zu", 'ぜ': "ze", 'ぞ': "zo",
+	'た': "ta", 'ち': "chi", 'つ': "tsu", 'て': "te", 'と': "to",
+	'だ': "da", 'ぢ': "ji", 'づ': "zu", 'で': "de", 'ど': "do",
+	'な': "na", 'に': "ni", 'ぬ': "nu", 'ね': "ne", 'の': "no",
+	'は': "ha", 'ひ': "hi", 'ふ': "fu", 'へ': "he", 'ほ': "ho",
+	'ば': "ba", 'び': "bi", 'ぶ': "bu", 'べ': "be", 'ぼ': "bo",
+	'ぱ': "pa", 'ぴ': "pi", 'ぷ': "pu", 'ぺ': "pe", 'ぽ': "po",
+	'ま': "ma", 'み': "mi", 'む': "mu", 'め': "me", 'も': "mo",
+	'や': "ya", 'ゆ': "yu", 'よ': "yo",
+	'ら': "ra", 'り': "ri", 'る': "ru", 'れ': "re", 'ろ': "ro",
+	'わ': "wa", 'ゐ': "i", 'ゑ': "e", 'を': "o", 'ん': "n",
+	'ゔ': "vu", 'ゕ': "ka", 'ゖ': "ke",
+	'ぁ': "a", 'ぃ': "i", 'ぅ': "u", 'ぇ': "e", 'ぉ': "o",
+	'ゃ': "ya", 'ゅ': "yu", 'ょ': "yo", 'ゎ': "wa", 'っ': "",
+	// Katakana-only letters
+	'ヷ': "va", 'ヸ': "vi", 'ヹ': "ve", 'ヺ': "vo",
+}
+
+func kanaValue(r rune) string {
+	if s, ok := kanaRomaji[r]; ok {
+		return s
+	}
+	if r >= 0x30A1 && r <= 0x30F6 {
+		return kanaRomaji[r-0x60]
+	}
+	return ""
+}
+
+// toHiragana maps katakana to hiragana so small-kana checks cover both.
+func toHiragana(r rune) rune {
+	if r >= 0x30A1 && r <= 0x30F6 {
+		return r - 0x60
+	}
+	return r
+}
+
+// kanaToRomaji converts a run of kana, handling digraphs (きゃ → kya), small
+// vowels (ファ → fa), the sokuon (っ doubles the next consonant) and the
+// long vowel mark (ー repeats the previous vowel).
+func kanaToRomaji(run []rune) string {
+	var out strings.Builder
+	double := false
+	for i := 0; i < len(run); i++ {
+		h := toHiragana(run[i])
+		if h == 'っ' {
+			double = true
+			continue
+		}
+		if run[i] == 'ー' {
+			s := out.String()
+			if n := len(s); n > 0 && strings.ContainsRune("aeiou", rune(s[n-1])) {
+				out.WriteByte(s[n-1])
+			}
+			continue
+		}
+		syl := kanaValue(run[i])
+		if i+1 < len(run) {
+			next := toHiragana(run[i+1])
+			switch {
+			case (next == 'ゃ' || next == 'ゅ' || next == 'ょ') && strings.HasSuffix(syl, "i") && len(syl) > 1:
+				stem := syl[:len(syl)-1]
+				vowel := kanaRomaji[next][1:]
+				if stem == "sh" || stem == "ch" || stem == "j" {
+					syl = stem + vowel
+				} else {
+					syl = stem + "y" + vowel
+				}
+				i++
+			case (next == 'ぁ' || next == 'ぃ' || next == 'ぅ' || next == 'ぇ' || next == 'ぉ') && len(syl) > 1:
+				syl = strings.TrimRight(syl, "aeiou") + kanaRomaji[next]
+				i++
+			}
+		}
+		if double && syl != "" {
+			if strings.HasPrefix(syl, "ch") {
+				out.WriteByte('t')
+			} else if c := syl[0]; !strings.ContainsRune("aeiou", rune(c)) {
+				out.WriteByte(c)
+			}
+		}
+		double = false
+		out.WriteString(syl)
+	}
+	return out.String()
+}
@@ -0,0 +1,45 @@
+package ncm
+
+import "testing"
+
+func TestTransliterate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"周杰伦", "Zhou Jie Lun"},
+		{"晴天 - 周杰伦", "Qing Tian - Zhou Jie Lun"},
+		{"Love周杰伦", "Love Zhou Jie Lun"},
+		{"A1晴天", "A1 Qing Tian"},
+		{"ありがとう", "arigatou"},
+		{"カタカナ", "katakana"},
+		{"ラーメン", "raamen"},
+		{"きょう", "kyou"},
+		{"がっこう", "gakkou"},
+		{"こんにちは世界", "konnichiha Shi Jie"},
+		// Kanji are read as Chinese
+		{"日本語のうた", "Ri Ben Yu nouta"},
+		{"Beyoncé", "Beyonce"},
+		{"Straße", "Strasse"},
+		{"Ørsted", "Orsted"},
+		{"Ælfred", "AElfred"},
+		{"Ｆｕｌｌ", "Full"},
+		{"♪音乐", "Yin Le"},
+		{"€5", "5"},
+		{"한국", ""},
+		{"  plain   ascii ", "plain ascii"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got := Transliterate(tt.in)
+			if got != tt.want {
+				t.Errorf("Transliterate(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+			for _, r := range got {
+				if r >= 0x80 {
+					t.Errorf("non-ASCII %q in %q", r, got)
+				}
+			}
+		})
+	}
+}
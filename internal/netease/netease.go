@@ -0,0 +1,278 @@
+// Package netease looks up song details on a NeteaseCloudMusicApi-compatible
+// server (https://github.com/Binaryify/NeteaseCloudMusicApi), typically a
+// self-hosted instance. It fills in what NCM metadata lacks: track and disc
+// number, release year, album artist, lyrics and the full-size cover URL.
+package netease
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"PureNCM/internal/lyrics"
+	"PureNCM/internal/ncm"
+)
+
+// ErrOffline is returned by Lookup in offline mode when the song is not cached.
+var ErrOffline = errors.New("offline mode: song details not cached")
+
+// ErrNotFound is returned when the server does not know the song ID.
+var ErrNotFound = errors.New("song not found")
+
+// maxResponseBytes caps an API response; song, album and lyric payloads are
+// a few hundred KB at most.
+const maxResponseBytes = 8 << 20
+
+// Client queries one API server.
+type Client struct {
+	// BaseURL is the server root, e.g. "http://localhost:3000".
+	BaseURL string
+	// HTTP performs the requests; nil uses http.DefaultClient.
+	HTTP *http.Client
+	// CacheDir keeps one JSON file per song ID; "" disables the cache.
+	CacheDir string
+	// Offline answers from the cache only and never touches the network.
+	Offline bool
+}
+
+// Song is the enrichment data for one song. Zero fields are unknown.
+type Song struct {
+	ID          string `json:"id"`
+	Track       int    `json:"track"`
+	Disc        int    `json:"disc"`
+	Year        int    `json:"year"`
+	AlbumArtist string `json:"albumArtist"`
+	CoverURL    string `json:"coverUrl"` // original size, no ?param= resize
+	// Lyrics in LRC form, as returned by /lyric
+	Lyric       string `json:"lyric"`
+	Translation string `json:"translation"`
+	Romaji      string `json:"romaji"`
+}
+
+// Lyrics returns the song's lyrics, or nil when the server had none.
+func (s *Song) Lyrics() *lyrics.CachedLyrics {
+	if strings.TrimSpace(s.Lyric) == "" {
+		return nil
+	}
+	return &lyrics.CachedLyrics{Lyric: s.Lyric, Translation: s.Translation, Romaji: s.Romaji}
+}
+
+// ValidateBaseURL checks that s is an absolute http(s) URL.
+func ValidateBaseURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("must be an http:// or https:// address")
+	}
+	return nil
+}
+
+// Lookup returns the details of song id, from the cache when present. Only
+// the song itself is required; album and lyric failures leave those fields
+// empty, and the song is then not cached so the next lookup tries again.
+func (c *Client) Lookup(ctx context.Context, id string) (*Song, error) {
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid song id %q", id)
+	}
+	if s, err := c.loadCache(id); err == nil {
+		return s, nil
+	}
+	if c.Offline {
+		return nil, ErrOffline
+	}
+
+	var detail songDetailResponse
+	if err := c.get(ctx, "/song/detail", url.Values{"ids": {id}}, &detail); err != nil {
+		return nil, err
+	}
+	if len(detail.Songs) == 0 {
+		return nil, ErrNotFound
+	}
+	sd := detail.Songs[0]
+	s := &Song{
+		ID:       id,
+		Track:    sd.No,
+		Disc:     parseDisc(sd.CD),
+		Year:     yearOf(sd.PublishTime),
+		CoverURL: stripImageParams(sd.Al.PicURL),
+	}
+
+	complete := true
+	if sd.Al.ID != 0 {
+		var album albumResponse
+		if err := c.get(ctx, "/album", url.Values{"id": {strconv.FormatInt(sd.Al.ID, 10)}}, &album); err != nil {
+			complete = false
+		} else {
+			s.AlbumArtist = album.Album.Artist.Name
+			if y := yearOf(album.Album.PublishTime); y > 0 {
+				s.Year = y // the album date is the release date; the song's is often 0
+			}
+			if s.CoverURL == "" {
+				s.CoverURL = stripImageParams(album.Album.PicURL)
+			}
+		}
+	}
+
+	var lyric lyricResponse
+	if err := c.get(ctx, "/lyric", url.Values{"id": {id}}, &lyric); err != nil {
+		complete = false
+	} else {
+		s.Lyric = lyric.Lrc.Lyric
+		s.Translation = lyric.Tlyric.Lyric
+		s.Romaji = lyric.Romalrc.Lyric
+	}
+
+	if complete {
+		c.saveCache(s)
+	}
+	return s, nil
+}
+
+// get requests path on the server and decodes the JSON response into v.
+func (c *Client) get(ctx context.Context, path string, query url.Values, v any) error {
+	u := strings.TrimRight(c.BaseURL, "/") + path + "?" + query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", path, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return err
+	}
+	// The API reports errors in the body as well, e.g. {"code": 404}
+	var status struct {
+		Code int `json:"code"`
+	}
+	if err := json.Unmarshal(data, &status); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if status.Code != 0 && status.Code != http.StatusOK {
+		return fmt.Errorf("%s: api code %d", path, status.Code)
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Response shapes, limited to the fields used.
+type (
+	songDetailResponse struct {
+		Songs []struct {
+			No          int    `json:"no"`
+			CD          string `json:"cd"` // "01", "1" or "1/2"
+			PublishTime int64  `json:"publishTime"`
+			Al          struct {
+				ID     int64  `json:"id"`
+				PicURL string `json:"picUrl"`
+			} `json:"al"`
+		} `json:"songs"`
+	}
+	albumResponse struct {
+		Album struct {
+			PicURL      string `json:"picUrl"`
+			PublishTime int64  `json:"publishTime"`
+			Artist      struct {
+				Name string `json:"name"`
+			} `json:"artist"`
+		} `json:"album"`
+	}
+	lyricResponse struct {
+		Lrc     struct{ Lyric string } `json:"lrc"`
+		Tlyric  struct{ Lyric string } `json:"tlyric"`
+		Romalrc struct{ Lyric string } `json:"romalrc"`
+	}
+)
+
+// discNumber matches the leading number of "01" or "1/2".
+var discNumber = regexp.MustCompile(`^\s*(\d+)`)
+
+func parseDisc(cd string) int {
+	m := discNumber.FindStringSubmatch(cd)
+	if m == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(m[1])
+	return n
+}
+
+// yearOf converts a publishTime in Unix milliseconds to a year. NetEase
+// uses 0 and negative values for unknown dates.
+func yearOf(ms int64) int {
+	if ms <= 0 {
+		return 0
+	}
+	// Release dates are midnight Beijing time, which is the previous day in UTC
+	return time.UnixMilli(ms).In(beijing).Year()
+}
+
+var beijing = time.FixedZone("CST", 8*60*60)
+
+// stripImageParams drops resize parameters such as "?param=130y130" so the
+// original image is fetched.
+func stripImageParams(u string) string {
+	if i := strings.IndexByte(u, '?'); i >= 0 {
+		return u[:i]
+	}
+	return u
+}
+
+func (c *Client) cachePath(id string) string {
+	if c.CacheDir == "" {
+		return ""
+	}
+	return filepath.Join(c.CacheDir, id+".json")
+}
+
+func (c *Client) loadCache(id string) (*Song, error) {
+	path := c.cachePath(id)
+	if path == "" {
+		return nil, os.ErrNotExist
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Song
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// saveCache stores s; a failed write only costs a lookup next time.
+func (c *Client) saveCache(s *Song) {
+	path := c.cachePath(s.ID)
+	if path == "" {
+		return
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(c.CacheDir, 0755); err != nil {
+		return
+	}
+	_ = ncm.WriteFileAtomic(path, data)
+}
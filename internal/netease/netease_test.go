@@ -0,0 +1,183 @@
+package netease
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// stubServer answers like NeteaseCloudMusicApi for song 1 of album 10.
+// Endpoints listed in failing return 500; requests are counted by path.
+type stubServer struct {
+	mu       sync.Mutex
+	failing  map[string]bool
+	requests map[string]int
+}
+
+func newStub(t *testing.T) (*stubServer, *httptest.Server) {
+	st := &stubServer{failing: map[string]bool{}, requests: map[string]int{}}
+	srv := httptest.NewServer(st)
+	t.Cleanup(srv.Close)
+	return st, srv
+}
+
+func (st *stubServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	st.mu.Lock()
+	st.requests[r.URL.Path]++
+	failing := st.failing[r.URL.Path]
+	st.mu.Unlock()
+	if failing {
+		http.Error(w, "boom", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/song/detail":
+		if r.URL.Query().Get("ids") != "1" {
+			_, _ = w.Write([]byte(`{"code":200,"songs":[]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"code":200,"songs":[{"no":3,"cd":"2/2","publishTime":0,
+			"al":{"id":10,"picUrl":"http://img.example/cover.jpg?param=130y130"}}]}`))
+	case "/album":
+		// 2020-01-01 00:00 Beijing time
+		_, _ = w.Write([]byte(`{"code":200,"album":{"publishTime":1577808000000,"artist":{"name":"Band"}}}`))
+	case "/lyric":
+		_, _ = w.Write([]byte(`{"code":200,"lrc":{"lyric":"[00:01.00]la"},"tlyric":{"lyric":"[00:01.00]啦"}}`))
+	default:
+		_, _ = w.Write([]byte(`{"code":404}`))
+	}
+}
+
+func (st *stubServer) set(path string, failing bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.failing[path] = failing
+}
+
+func (st *stubServer) count(path string) int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.requests[path]
+}
+
+func TestLookup(t *testing.T) {
+	want := Song{
+		ID:          "1",
+		Track:       3,
+		Disc:        2,
+		Year:        2020,
+		AlbumArtist: "Band",
+		CoverURL:    "http://img.example/cover.jpg",
+		Lyric:       "[00:01.00]la",
+		Translation: "[00:01.00]啦",
+	}
+	tests := []struct {
+		name    string
+		failing []string
+		want    Song
+		cached  bool
+	}{
+		{"complete", nil, want, true},
+		{"album fails", []string{"/album"}, Song{ID: "1", Track: 3, Disc: 2, CoverURL: want.CoverURL,
+			Lyric: want.Lyric, Translation: want.Translation}, false},
+		{"lyric fails", []string{"/lyric"}, Song{ID: "1", Track: 3, Disc: 2, Year: 2020,
+			AlbumArtist: "Band", CoverURL: want.CoverURL}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st, srv := newStub(t)
+			for _, p := range tt.failing {
+				st.set(p, true)
+			}
+			c := &Client{BaseURL: srv.URL + "/", HTTP: srv.Client(), CacheDir: t.TempDir()}
+			s, err := c.Lookup(context.Background(), "1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *s != tt.want {
+				t.Errorf("Lookup = %+v\nwant %+v", *s, tt.want)
+			}
+			_, err = os.Stat(filepath.Join(c.CacheDir, "1.json"))
+			if cached := err == nil; cached != tt.cached {
+				t.Errorf("cached = %v, want %v", cached, tt.cached)
+			}
+		})
+	}
+}
+
+func TestLookupRetriesIncomplete(t *testing.T) {
+	st, srv := newStub(t)
+	c := &Client{BaseURL: srv.URL, HTTP: srv.Client(), CacheDir: t.TempDir()}
+	st.set("/lyric", true)
+	if s, err := c.Lookup(context.Background(), "1"); err != nil || s.Lyric != "" {
+		t.Fatalf("first Lookup = %+v, %v", s, err)
+	}
+	st.set("/lyric", false)
+	s, err := c.Lookup(context.Background(), "1")
+	if err != nil || s.Lyric == "" {
+		t.Fatalf("second Lookup = %+v, %v; want lyrics", s, err)
+	}
+	if n := st.count("/song/detail"); n != 2 {
+		t.Errorf("%d detail requests, want 2", n)
+	}
+}
+
+func TestLookupCache(t *testing.T) {
+	st, srv := newStub(t)
+	dir := t.TempDir()
+	c := &Client{BaseURL: srv.URL, HTTP: srv.Client(), CacheDir: dir}
+	first, err := c.Lookup(context.Background(), "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := st.count("/song/detail") + st.count("/album") + st.count("/lyric")
+
+	// A second client, offline, reads the cache the first one wrote
+	offline := &Client{BaseURL: srv.URL, CacheDir: dir, Offline: true}
+	for _, c := range []*Client{c, offline} {
+		s, err := c.Lookup(context.Background(), "1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *s != *first {
+			t.Errorf("cached Lookup = %+v, want %+v", *s, *first)
+		}
+	}
+	if after := st.count("/song/detail") + st.count("/album") + st.count("/lyric"); after != before {
+		t.Errorf("cache hits made %d requests", after-before)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("cache dir holds %d files, want 1", len(entries))
+	}
+}
+
+func TestLookupErrors(t *testing.T) {
+	st, srv := newStub(t)
+	c := &Client{BaseURL: srv.URL, HTTP: srv.Client()}
+	if _, err := c.Lookup(context.Background(), "2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown id: %v, want ErrNotFound", err)
+	}
+	if _, err := c.Lookup(context.Background(), "../1"); err == nil {
+		t.Error("invalid id accepted")
+	}
+	st.set("/song/detail", true)
+	if _, err := c.Lookup(context.Background(), "1"); err == nil {
+		t.Error("failed detail request: no error")
+	}
+	offline := &Client{BaseURL: srv.URL, CacheDir: t.TempDir(), Offline: true}
+	if _, err := offline.Lookup(context.Background(), "1"); !errors.Is(err, ErrOffline) {
+		t.Errorf("offline miss: %v, want ErrOffline", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	st.set("/song/detail", false)
+	if _, err := c.Lookup(ctx, "1"); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled: %v, want context.Canceled", err)
+	}
+}
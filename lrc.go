@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"PureNCM/internal/config"
+	"PureNCM/internal/lyrics"
+	"PureNCM/internal/ncm"
+	"PureNCM/internal/netease"
+)
+
+// LyricsResult reports what happened to a file's lyrics. It is attached to
+// the final ConvertProgress event when lyrics handling is enabled.
+type LyricsResult struct {
+	Source   string `json:"source,omitempty"`   // .lrc, lyric cache file or API URL used; empty when none was found
+	Encoding string `json:"encoding,omitempty"` // detected encoding of Source, e.g. "GBK"
+	Embedded bool   `json:"embedded"`           // lyrics were written into the audio tags
+	Sidecar  string `json:"sidecar,omitempty"`  // path of the .lrc written next to the output
+	Error    string `json:"error,omitempty"`
+}
+
+// lyricOptions are the lyrics settings of a batch.
+type lyricOptions struct {
+	mode       string   // config.LrcMode*
+	searchDirs []string // extra dirs searched by title and artist
+	cacheDir   string   // NetEase client lyric cache
+	merge      lyrics.MergeOptions
+	api        string // enrichment server, named as the source of its lyrics
+}
+
+// lyricSettings returns the lyrics settings of cfg, or nil when lyrics
+// handling is disabled.
+func lyricSettings(cfg *config.Config) *lyricOptions {
+	if !cfg.CopyLrc {
+		return nil
+	}
+	dir := cfg.LyricsCacheDir
+	if dir == "" {
+		dir = lyrics.DefaultCacheDir()
+	}
+	return &lyricOptions{
+		mode:       cfg.LrcMode,
+		searchDirs: slices.Clone(cfg.LrcSearchDirs),
+		cacheDir:   dir,
+		merge:      lyrics.MergeOptions{Layout: cfg.LyricsLayout, Romaji: cfg.LyricsRomaji},
+		api:        cfg.NeteaseAPI,
+	}
+}
+
+// songLyrics holds the lyrics found for one conversion.
+type songLyrics struct {
+	text   string // UTF-8 LRC text
+	mode   string // config.LrcMode*
+	result *LyricsResult
+}
+
+// findLyrics locates and decodes the lyrics for a song. A matching .lrc file
+// wins; otherwise the NetEase client lyric cache is tried by song ID, then
+// the lyrics from enrichment (song may be nil), merging translations per the
+// configured layout. It returns nil when opts is nil.
+func findLyrics(opts *lyricOptions, srcNCM string, meta *ncm.Meta, song *netease.Song) *songLyrics {
+	if opts == nil {
+		return nil
+	}
+	sl := &songLyrics{mode: opts.mode, result: &LyricsResult{}}
+	path := lyrics.Find(lyrics.FindOptions{
+		Source:    srcNCM,
+		Title:     meta.MusicName,
+		Artists:   meta.ArtistNames(),
+		ExtraDirs: opts.searchDirs,
+	})
+	if path == "" {
+		sl.fromCache(opts, string(meta.MusicID))
+		if sl.text == "" && sl.result.Error == "" && song != nil {
+			sl.fromAPI(opts, song)
+		}
+		return sl
+	}
+	text, enc, err := lyrics.Load(path)
+	if err != nil {
+		sl.result.Error = err.Error()
+		return sl
+	}
+	sl.text = text
+	sl.result.Source = path
+	sl.result.Encoding = enc
+	return sl
+}
+
+// fromCache fills sl from the NetEase client lyric cache entry for songID.
+func (sl *songLyrics) fromCache(opts *lyricOptions, songID string) {
+	cached, err := lyrics.LoadCache(opts.cacheDir, songID)
+	if err != nil {
+		if !errors.Is(err, lyrics.ErrNotCached) {
+			sl.result.Error = err.Error()
+		}
+		return
+	}
+	sl.text = cached.Merge(opts.merge).String()
+	sl.result.Source = lyrics.CachePath(opts.cacheDir, songID)
+	sl.result.Encoding = lyrics.EncodingUTF8
+}
+
+// fromAPI fills sl from the lyrics returned by the enrichment server.
+func (sl *songLyrics) fromAPI(opts *lyricOptions, song *netease.Song) {
+	cached := song.Lyrics()
+	if cached == nil {
+		return
+	}
+	sl.text = cached.Merge(opts.merge).String()
+	sl.result.Source = opts.api + "/lyric?id=" + song.ID
+	sl.result.Encoding = lyrics.EncodingUTF8
+}
+
+// toEmbed returns the parsed lyrics to embed in the tags, or nil when
+// nothing was found or the mode is sidecar-only.
+func (sl *songLyrics) toEmbed() *lyrics.LRC {
+	if sl == nil || sl.text == "" || sl.mode == config.LrcModeSidecar {
+		return nil
+	}
+	lrc := lyrics.Parse(sl.text)
+	if lrc.IsEmpty() {
+		return nil
+	}
+	return lrc
+}
+
+// finish records the embed outcome and writes the UTF-8 .lrc sidecar named
+// after outPath, unless the mode is embed-only.
+func (sl *songLyrics) finish(outPath string, embedded bool) *LyricsResult {
+	if sl == nil {
+		return nil
+	}
+	sl.result.Embedded = embedded
+	if sl.text == "" || sl.mode == config.LrcModeEmbed {
+		return sl.result
+	}
+	dst := strings.TrimSuffix(outPath, filepath.Ext(outPath)) + ".lrc"
+	if strings.EqualFold(filepath.Clean(dst), filepath.Clean(sl.result.Source)) && sl.result.Encoding == lyrics.EncodingUTF8 {
+		// The source .lrc already sits next to the output under the right name
+		sl.result.Sidecar = dst
+		return sl.result
+	}
+	if err := ncm.WriteFileAtomic(dst, []byte(sl.text)); err != nil {
+		sl.result.Error = err.Error()
+		return sl.result
+	}
+	sl.result.Sidecar = dst
+	return sl.result
+}
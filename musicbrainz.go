@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"PureNCM/internal/config"
+	"PureNCM/internal/musicbrainz"
+	"PureNCM/internal/ncm"
+	"PureNCM/internal/netclient"
+)
+
+// MusicBrainzResult reports the MusicBrainz lookup for one file. It is
+// attached to the final ConvertProgress event when the stage is enabled.
+type MusicBrainzResult struct {
+	RecordingID string `json:"recordingId,omitempty"` // empty when nothing matched
+	Score       int    `json:"score,omitempty"`       // 0–100
+	Error       string `json:"error,omitempty"`
+}
+
+// SetMusicBrainzConfig validates and saves the MusicBrainz lookup settings.
+func (a *App) SetMusicBrainzConfig(c config.MusicBrainzConfig) error {
+	if c.BaseURL != "" {
+		u, err := url.Parse(c.BaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("MusicBrainz 地址无效：%s", c.BaseURL)
+		}
+	}
+	return config.SetMusicBrainz(c)
+}
+
+// musicBrainzClient returns the lookup client for a batch, paced by limiter,
+// or nil when the stage is off. Offline mode turns it off as there is no
+// cache.
+func musicBrainzClient(cfg *config.Config, limiter *musicbrainz.Limiter) *musicbrainz.Client {
+	mb := cfg.MusicBrainz
+	if !mb.Enabled || cfg.Offline {
+		return nil
+	}
+	return &musicbrainz.Client{
+		BaseURL:  mb.BaseURL,
+		HTTP:     httpClient(),
+		Interval: time.Duration(mb.RateLimitMs) * time.Millisecond,
+		MinScore: float64(mb.MinScore) / 100,
+		Limiter:  limiter,
+		Retries:  cfg.Network.Retries,
+	}
+}
+
+// matchMusicBrainz looks meta up on MusicBrainz and, on a confident match,
+// records the IDs and optionally the canonical names. It returns nil when
+// the stage is off.
+func (b *batch) matchMusicBrainz(ctx context.Context, meta *ncm.Meta) *MusicBrainzResult {
+	if b.musicbrainz == nil {
+		return nil
+	}
+	// The client retries by itself, so retries keep to the rate limit too
+	m, err := b.musicbrainz.Lookup(netclient.WithoutRetries(ctx), musicbrainz.Query{
+		Title:    meta.MusicName,
+		Artists:  meta.ArtistNames(),
+		Album:    meta.Album,
+		Duration: time.Duration(meta.Duration) * time.Millisecond,
+	})
+	if errors.Is(err, musicbrainz.ErrNoMatch) {
+		return &MusicBrainzResult{}
+	}
+	if err != nil {
+		return &MusicBrainzResult{Error: err.Error()}
+	}
+	meta.MusicBrainz = ncm.MusicBrainzIDs{
+		RecordingID:    m.RecordingID,
+		ReleaseID:      m.ReleaseID,
+		ReleaseGroupID: m.ReleaseGroupID,
+		ArtistIDs:      m.ArtistIDs,
+	}
+	if b.canonical {
+		meta.MusicName = m.Title
+		if len(m.Artists) > 0 {
+			meta.SetArtistNames(m.Artists)
+		}
+		if m.Album != "" {
+			meta.Album = m.Album
+		}
+	}
+	return &MusicBrainzResult{RecordingID: m.RecordingID, Score: int(m.Score*100 + 0.5)}
+}
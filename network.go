@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"PureNCM/internal/config"
+	"PureNCM/internal/netclient"
+)
+
+// The HTTP client shared by all network features. It is built from the
+// network settings on first use and rebuilt when they change; batches that
+// are already running keep the client they started with.
+var (
+	clientMu     sync.Mutex
+	sharedClient *http.Client
+)
+
+// SetNetworkConfig validates and saves the proxy and download settings. A
+// custom proxy may be saved without a URL while the user is still entering it.
+func (a *App) SetNetworkConfig(c config.NetworkConfig) error {
+	if c.ProxyMode == config.ProxyCustom && c.ProxyURL != "" {
+		if _, err := netclient.ParseProxyURL(c.ProxyURL); err != nil {
+			return fmt.Errorf("代理地址无效：%v", err)
+		}
+	}
+	if err := config.SetNetwork(c); err != nil {
+		return err
+	}
+	clientMu.Lock()
+	sharedClient = nil
+	clientMu.Unlock()
+	return nil
+}
+
+// httpClient returns the shared client for the current network settings.
+func httpClient() *http.Client {
+	clientMu.Lock()
+	defer clientMu.Unlock()
+	if sharedClient == nil {
+		c, err := netclient.New(networkOptions(config.Get().Network))
+		if err != nil {
+			// Only a missing or hand-edited proxy URL can fail; fall back
+			// to the environment proxy rather than disabling downloads
+			c, _ = netclient.New(netclient.Options{})
+		}
+		sharedClient = c
+	}
+	return sharedClient
+}
+
+// networkOptions maps the persisted network settings onto netclient.Options.
+func networkOptions(c config.NetworkConfig) netclient.Options {
+	return netclient.Options{
+		ProxyMode:     c.ProxyMode,
+		ProxyURL:      c.ProxyURL,
+		Timeout:       time.Duration(c.TimeoutSeconds) * time.Second,
+		Retries:       c.Retries,
+		MaxConcurrent: c.MaxConcurrent,
+		UserAgent:     c.UserAgent,
+	}
+}
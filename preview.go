@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"PureNCM/internal/config"
+	"PureNCM/internal/ncm"
+)
+
+// FilenamePreview is the preview of one file's output path for a pattern.
+type FilenamePreview struct {
+	Path     string   `json:"path"`               // source .ncm file
+	Output   string   `json:"output"`             // output path relative to the output directory
+	Warnings []string `json:"warnings,omitempty"` // human-readable problems with the result
+	Error    string   `json:"error,omitempty"`    // the file could not be read
+}
+
+// PreviewFilenames renders pattern for each file without converting it. Only
+// the metadata is read (no audio is decrypted), so it is cheap enough to run
+// while the user types. Paths are previewed as one batch, in order, so {index}
+// and duplicate names match what ConvertFiles would produce.
+func (a *App) PreviewFilenames(pattern string, paths []string) ([]FilenamePreview, error) {
+	tmpl, err := ncm.ParseTemplate(pattern)
+	if err != nil {
+		return nil, err
+	}
+	cfg := config.Get()
+	b := a.newBatch(cfg.OutputDir, pattern, len(paths))
+
+	previews := make([]FilenamePreview, len(paths))
+	owners := map[string]string{} // folded output path → first source using it
+	for i, p := range paths {
+		pv := &previews[i]
+		pv.Path = p
+		probe, err := ncm.ProbeFile(p)
+		if err != nil {
+			pv.Error = err.Error()
+			continue
+		}
+		inferred := b.fillMissing(p, probe.Meta, probe.MetaErr)
+		b.prepareMeta(probe.Meta)
+		d := b.templateData(p, i+1, probe.Meta, probe.Format)
+		outDir := b.outDirFor(p)
+		full := ncm.OutputPath(d, outDir, pattern)
+		if rel, err := filepath.Rel(outDir, full); err == nil {
+			pv.Output = rel
+		} else {
+			pv.Output = full
+		}
+
+		if len(inferred) > 0 {
+			pv.Warnings = append(pv.Warnings, "元数据缺失，已从文件名推断："+fieldLabels(inferred))
+		}
+		_, report := tmpl.RenderWithReport(d)
+		if len(report.Empty) > 0 {
+			names := make([]string, len(report.Empty))
+			for j, n := range report.Empty {
+				names[j] = "{" + n + "}"
+			}
+			pv.Warnings = append(pv.Warnings, "占位符为空："+strings.Join(names, "、"))
+		}
+		if report.Sanitized {
+			pv.Warnings = append(pv.Warnings, "已移除文件名中的非法字符")
+		}
+		if report.TooLong {
+			pv.Warnings = append(pv.Warnings, "文件名过长，部分系统可能无法创建")
+		}
+
+		key := strings.ToLower(filepath.Clean(full))
+		if first, ok := owners[key]; ok {
+			pv.Warnings = append(pv.Warnings, fmt.Sprintf("与 %s 的输出文件重名，将追加序号", filepath.Base(first)))
+		} else {
+			owners[key] = p
+			if _, err := os.Stat(full); err == nil {
+				pv.Warnings = append(pv.Warnings, "输出文件已存在："+collisionLabel(cfg.CollisionPolicy))
+			}
+		}
+	}
+	return previews, nil
+}
+
+// collisionLabel describes what the collision policy will do with an
+// existing output file.
+func collisionLabel(policy string) string {
+	switch policy {
+	case config.CollisionSkip:
+		return "将跳过"
+	case config.CollisionRename:
+		return "将追加序号"
+	case config.CollisionReplaceIfBetter:
+		return "音质更好时替换"
+	default:
+		return "将覆盖"
+	}
+}
+
+// fieldLabels names inferred metadata fields for display.
+func fieldLabels(fields []string) string {
+	labels := map[string]string{"title": "标题", "artist": "歌手", "album": "专辑", "track": "音轨号"}
+	out := make([]string, len(fields))
+	for i, f := range fields {
+		out[i] = labels[f]
+	}
+	return strings.Join(out, "、")
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	wailsRuntime "github.com/wailsapp/wails/v2/pkg/runtime"
+
+	"PureNCM/internal/ncm"
+)
+
+// Job statuses. A job is "pending" while queued; the others match the
+// ConvertProgress status of its events.
+const (
+	StatusPending    = "pending"
+	StatusConverting = "converting"
+	StatusDone       = "done"
+	StatusSkipped    = "skipped"
+	StatusError      = "error"
+	StatusCancelled  = "cancelled"
+)
+
+// Job is one file in the conversion queue. The queue is the source of truth
+// for the file list: the frontend loads it with GetQueue and keeps it
+// current from the progress events.
+type Job struct {
+	ID       string  `json:"id"`
+	BatchID  string  `json:"batchId"`
+	Path     string  `json:"path"`
+	Index    int     `json:"index"` // 1-based position in its batch, for {index}
+	Status   string  `json:"status"`
+	Size     int64   `json:"size"`
+	Progress float64 `json:"progress"`
+	// Result is the final event of a finished job, so a reloaded frontend
+	// shows the same details as a live one.
+	Result *ConvertProgress `json:"result,omitempty"`
+
+	cancel context.CancelFunc // set while converting
+}
+
+// finished reports whether the job has reached a final status.
+func (j *Job) finished() bool {
+	return j.Status != StatusPending && j.Status != StatusConverting
+}
+
+// QueueState is the event payload emitted when a batch starts or finishes
+// and when the queue is paused or resumed.
+type QueueState struct {
+	Running bool     `json:"running"` // some job is pending or converting
+	Paused  bool     `json:"paused"`
+	Batches []string `json:"batches"` // IDs of the batches with unfinished jobs
+}
+
+const EventQueueState = "ncm:queue"
+
+// eventsEmit and notify send events to the frontend and desktop
+// notifications; tests replace them.
+var (
+	eventsEmit = wailsRuntime.EventsEmit
+	notify     = sendNotification
+)
+
+// shutdownWait bounds how long closing the window waits for cancelled
+// workers to remove their partial output.
+const shutdownWait = 5 * time.Second
+
+// Enqueue adds a batch of files to the queue and returns its ID, which is
+// carried by every event of the batch. Jobs start as soon as a worker is
+// free; batches share the workers and run in queue order. Output paths are
+// planned in the background, so Enqueue returns without reading the files.
+func (a *App) Enqueue(paths []string, outputDir string, pattern string) (string, error) {
+	if len(paths) == 0 {
+		return "", errors.New("没有要转换的文件")
+	}
+	b := a.newBatch(outputDir, pattern, len(paths))
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closing {
+		return "", errors.New("应用正在退出")
+	}
+	b.id = a.newBatchID()
+	b.planned = make([]chan struct{}, len(paths))
+	for i := range b.planned {
+		b.planned[i] = make(chan struct{})
+	}
+	go b.planOutputs(paths)
+	b.active = true
+	a.batches[b.id] = b
+	for i, p := range paths {
+		a.jobs = append(a.jobs, &Job{
+			ID:      jobID(b.id, i+1),
+			BatchID: b.id,
+			Path:    p,
+			Index:   i + 1,
+			Status:  StatusPending,
+		})
+	}
+	a.startWorkers()
+	a.wake.Broadcast()
+	a.emitQueueState()
+	a.saveQueue()
+	return b.id, nil
+}
+
+// GetQueue returns every job in queue order.
+func (a *App) GetQueue() []Job {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	jobs := make([]Job, len(a.jobs))
+	for i, j := range a.jobs {
+		jobs[i] = *j
+		jobs[i].cancel = nil
+	}
+	return jobs
+}
+
+// GetQueueState returns the state last sent as an "ncm:queue" event.
+func (a *App) GetQueueState() QueueState {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.queueState()
+}
+
+// Remove takes a job out of the queue, cancelling it first when it is
+// being converted.
+func (a *App) Remove(id string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	i := a.jobIndex(id)
+	if i < 0 {
+		return errors.New("任务不存在")
+	}
+	j := a.jobs[i]
+	if j.cancel != nil {
+		j.cancel()
+	}
+	a.jobs = append(a.jobs[:i], a.jobs[i+1:]...)
+	a.reservations.Release(j.ID)
+	a.settle(j.BatchID)
+	if a.jobCount(j.BatchID) == 0 {
+		delete(a.batches, j.BatchID)
+	}
+	a.saveQueue()
+	return nil
+}
+
+// Reorder moves a job to position to in the queue. Only the order of
+// pending jobs matters: the first pending job is dispatched next.
+func (a *App) Reorder(id string, to int) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	i := a.jobIndex(id)
+	if i < 0 {
+		return errors.New("任务不存在")
+	}
+	j := a.jobs[i]
+	a.jobs = append(a.jobs[:i], a.jobs[i+1:]...)
+	to = min(max(to, 0), len(a.jobs))
+	a.jobs = append(a.jobs[:to], append([]*Job{j}, a.jobs[to:]...)...)
+	a.saveQueue()
+	return nil
+}
+
+// RetryFailed requeues the jobs that failed or were cancelled, in their
+// original batches, and returns how many there were.
+func (a *App) RetryFailed() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	n := 0
+	for _, j := range a.jobs {
+		if j.Status != StatusError && j.Status != StatusCancelled {
+			continue
+		}
+		j.Status, j.Progress, j.Result = StatusPending, 0, nil
+		a.batches[j.BatchID].active = true
+		n++
+	}
+	if n > 0 {
+		a.wake.Broadcast()
+		a.emitQueueState()
+		a.saveQueue()
+	}
+	return n
+}
+
+// PauseConversion stops dispatching queued files and parks the files being
+// converted at their next chunk. It does nothing when the queue is idle.
+func (a *App) PauseConversion() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.queueState().Running {
+		return
+	}
+	a.gate.Pause()
+	a.emitQueueState()
+}
+
+// ResumeConversion continues a paused queue.
+func (a *App) ResumeConversion() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.gate.Resume()
+	a.wake.Broadcast()
+	a.emitQueueState()
+}
+
+// CancelConversion stops every unfinished job. Files being converted stop
+// at their next chunk and remove any partial output; queued files are not
+// started. Each emits a "cancelled" event.
+func (a *App) CancelConversion() {
+	a.cancelJobs(func(*Job) bool { return true })
+}
+
+// CancelJob stops one job, whether it is queued or being converted.
+func (a *App) CancelJob(id string) {
+	a.cancelJobs(func(j *Job) bool { return j.ID == id })
+}
+
+// CancelFile stops the unfinished jobs converting path.
+func (a *App) CancelFile(path string) {
+	a.cancelJobs(func(j *Job) bool { return j.Path == path })
+}
+
+// cancelJobs cancels the unfinished jobs matching match. Queued jobs are
+// marked cancelled here; converting ones by convertOne when they stop.
+func (a *App) cancelJobs(match func(*Job) bool) {
+	var events []ConvertProgress
+	a.mu.Lock()
+	touched := map[string]bool{}
+	for _, j := range a.jobs {
+		if j.finished() || !match(j) {
+			continue
+		}
+		if j.cancel != nil {
+			j.cancel()
+			continue
+		}
+		ev := ConvertProgress{Path: j.Path, Status: StatusCancelled, Size: j.Size, JobID: j.ID, BatchID: j.BatchID}
+		j.Status, j.Result = StatusCancelled, &ev
+		events = append(events, ev)
+		touched[j.BatchID] = true
+	}
+	for id := range touched {
+		a.settle(id)
+	}
+	if len(events) > 0 {
+		a.saveQueue()
+	}
+	a.mu.Unlock()
+	for _, ev := range events {
+		eventsEmit(a.ctx, EventConvertProgress, ev)
+	}
+}
+
+// shutdown stops the workers when the window closes. Converting jobs are
+// cancelled, so no half-written files are left behind; it waits briefly
+// for them to clean up, then saves the queue so unfinished jobs can be
+// resumed next time.
+func (a *App) shutdown(ctx context.Context) {
+	a.mu.Lock()
+	a.closing = true
+	for _, j := range a.jobs {
+		if j.cancel != nil {
+			j.cancel()
+		}
+	}
+	a.wake.Broadcast()
+	a.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		a.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(shutdownWait):
+	}
+	a.mu.Lock()
+	a.saveQueue()
+	a.mu.Unlock()
+}
+
+// startWorkers starts the worker pool on first use. The caller holds a.mu.
+func (a *App) startWorkers() {
+	if a.started {
+		return
+	}
+	a.started = true
+	for range maxWorkers {
+		a.workers.Add(1)
+		go a.worker()
+	}
+}
+
+// worker converts jobs until the app shuts down.
+func (a *App) worker() {
+	defer a.workers.Done()
+	for {
+		ctx, j, b := a.nextJob()
+		if j == nil {
+			return
+		}
+		a.convertOne(ctx, j, b)
+		a.finish(j)
+	}
+}
+
+// nextJob waits for the first pending job while the queue is not paused,
+// marks it converting and returns it with its context. It returns a nil
+// job when the app shuts down.
+func (a *App) nextJob() (context.Context, *Job, *batch) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for !a.closing {
+		if !a.gate.Paused() {
+			for _, j := range a.jobs {
+				if j.Status != StatusPending {
+					continue
+				}
+				ctx, cancel := context.WithCancel(ncm.WithPauseGate(context.Background(), &a.gate))
+				j.Status, j.Progress, j.cancel = StatusConverting, 0, cancel
+				return ctx, j, a.batches[j.BatchID]
+			}
+		}
+		a.wake.Wait()
+	}
+	return nil, nil, nil
+}
+
+// finish releases a job's context after convertOne returns.
+func (a *App) finish(j *Job) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	j.cancel()
+	j.cancel = nil
+	a.settle(j.BatchID)
+	a.saveQueue()
+}
+
+// record stores ev on its job and emits it. Final events become the job's
+// Result. Jobs stopped by shutdown stay pending, to be resumed.
+func (a *App) record(j *Job, ev ConvertProgress) {
+	ev.JobID, ev.BatchID = j.ID, j.BatchID
+	a.mu.Lock()
+	if a.closing && ev.Status == StatusCancelled {
+		j.Status, j.Progress = StatusPending, 0
+		a.mu.Unlock()
+		return
+	}
+	if ev.Size > 0 {
+		j.Size = ev.Size
+	}
+	j.Status, j.Progress = ev.Status, ev.Progress
+	if j.finished() {
+		j.Result = &ev
+	}
+	a.mu.Unlock()
+	eventsEmit(a.ctx, EventConvertProgress, ev)
+}
+
+// settle checks whether batch id has just finished. The first time its last
+// job finishes its output paths are released, so later batches may write
+// them, and a notification is sent. Once no batch has work left the queue
+// is unpaused so the next batch starts running. The caller holds a.mu.
+func (a *App) settle(id string) {
+	b := a.batches[id]
+	if b == nil || !b.active {
+		return
+	}
+	var done, skipped, failed, cancelled, total int
+	for _, j := range a.jobs {
+		if j.BatchID != id {
+			continue
+		}
+		total++
+		switch j.Status {
+		case StatusPending, StatusConverting:
+			return
+		case StatusDone:
+			done++
+		case StatusSkipped:
+			skipped++
+		case StatusError:
+			failed++
+		case StatusCancelled:
+			cancelled++
+		}
+	}
+	b.active = false
+	a.release(id)
+	if total > 0 {
+		go notify(done, skipped, failed, cancelled, total)
+	}
+	if !a.queueState().Running {
+		a.gate.Resume()
+	}
+	a.emitQueueState()
+}
+
+// queueState returns the current QueueState. The caller holds a.mu.
+func (a *App) queueState() QueueState {
+	s := QueueState{Paused: a.gate.Paused(), Batches: []string{}}
+	for id, b := range a.batches {
+		if b.active {
+			s.Batches = append(s.Batches, id)
+		}
+	}
+	s.Running = len(s.Batches) > 0
+	return s
+}
+
+// emitQueueState sends the current QueueState. The caller holds a.mu.
+func (a *App) emitQueueState() {
+	eventsEmit(a.ctx, EventQueueState, a.queueState())
+}
+
+// release drops the output paths reserved by the jobs of batch id. Until
+// then they are kept, finished jobs' included, so that no job of the batch
+// takes the name of another. The caller holds a.mu.
+func (a *App) release(id string) {
+	for _, j := range a.jobs {
+		if j.BatchID == id {
+			a.reservations.Release(j.ID)
+		}
+	}
+}
+
+// jobID returns the ID of the index-th job (1-based) of batch batchID.
+func jobID(batchID string, index int) string {
+	return fmt.Sprintf("%s-%d", batchID, index)
+}
+
+// newBatchID returns an unused batch ID. The caller holds a.mu.
+func (a *App) newBatchID() string {
+	for t := time.Now().UnixNano(); ; t++ {
+		id := "b" + strconv.FormatInt(t, 36)
+		if _, ok := a.batches[id]; !ok {
+			return id
+		}
+	}
+}
+
+// jobIndex returns the position of job id in the queue, or -1. The caller
+// holds a.mu.
+func (a *App) jobIndex(id string) int {
+	for i, j := range a.jobs {
+		if j.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// jobCount returns the number of jobs of batch id in the queue. The caller
+// holds a.mu.
+func (a *App) jobCount(id string) int {
+	n := 0
+	for _, j := range a.jobs {
+		if j.BatchID == id {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// events records what the queue sends to the frontend.
+type events struct {
+	mu       sync.Mutex
+	progress []ConvertProgress
+	states   []QueueState
+}
+
+func (e *events) statuses() map[string]string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	out := map[string]string{}
+	for _, ev := range e.progress {
+		out[ev.JobID] = ev.Status
+	}
+	return out
+}
+
+// testApp returns an App whose events are recorded instead of sent. With
+// workers false the worker pool is never started, so jobs stay where the
+// test puts them.
+func testApp(t *testing.T, workers bool) (*App, *events) {
+	t.Helper()
+	ev := &events{}
+	emit, note := eventsEmit, notify
+	eventsEmit = func(_ context.Context, name string, data ...interface{}) {
+		ev.mu.Lock()
+		defer ev.mu.Unlock()
+		switch name {
+		case EventConvertProgress:
+			ev.progress = append(ev.progress, data[0].(ConvertProgress))
+		case EventQueueState:
+			ev.states = append(ev.states, data[0].(QueueState))
+		}
+	}
+	notify = func(done, skipped, failed, cancelled, total int) {}
+	t.Cleanup(func() { eventsEmit, notify = emit, note })
+
+	a := NewApp()
+	a.started = !workers
+	if workers {
+		t.Cleanup(func() { a.shutdown(context.Background()) })
+	}
+	return a, ev
+}
+
+// addJobs queues a batch of jobs with the given statuses.
+func addJobs(a *App, id string, statuses ...string) {
+	b := a.newBatch("", "", len(statuses))
+	b.id, b.active = id, true
+	a.batches[id] = b
+	for i, s := range statuses {
+		a.jobs = append(a.jobs, &Job{
+			ID:      id + "-" + string(rune('1'+i)),
+			BatchID: id,
+			Path:    id + string(rune('a'+i)) + ".ncm",
+			Index:   i + 1,
+			Status:  s,
+		})
+	}
+}
+
+func jobIDs(a *App) []string {
+	var ids []string
+	for _, j := range a.GetQueue() {
+		ids = append(ids, j.ID)
+	}
+	return ids
+}
+
+func jobStatuses(a *App) []string {
+	var s []string
+	for _, j := range a.GetQueue() {
+		s = append(s, j.Status)
+	}
+	return s
+}
+
+func TestQueueEdits(t *testing.T) {
+	tests := []struct {
+		name         string
+		edit         func(a *App) error
+		wantErr      bool
+		wantIDs      []string
+		wantStatuses []string
+	}{
+		{
+			name:         "reorder to the front",
+			edit:         func(a *App) error { return a.Reorder("b2-1", 0) },
+			wantIDs:      []string{"b2-1", "b1-1", "b1-2", "b1-3"},
+			wantStatuses: []string{StatusPending, StatusDone, StatusError, StatusPending},
+		},
+		{
+			name:         "reorder past the end",
+			edit:         func(a *App) error { return a.Reorder("b1-1", 99) },
+			wantIDs:      []string{"b1-2", "b1-3", "b2-1", "b1-1"},
+			wantStatuses: []string{StatusError, StatusPending, StatusPending, StatusDone},
+		},
+		{
+			name:         "reorder unknown job",
+			edit:         func(a *App) error { return a.Reorder("b9-1", 0) },
+			wantErr:      true,
+			wantIDs:      []string{"b1-1", "b1-2", "b1-3", "b2-1"},
+			wantStatuses: []string{StatusDone, StatusError, StatusPending, StatusPending},
+		},
+		{
+			name:         "remove",
+			edit:         func(a *App) error { return a.Remove("b1-2") },
+			wantIDs:      []string{"b1-1", "b1-3", "b2-1"},
+			wantStatuses: []string{StatusDone, StatusPending, StatusPending},
+		},
+		{
+			name: "retry failed",
+			edit: func(a *App) error {
+				if n := a.RetryFailed(); n != 1 {
+					return errors.New("wrong count")
+				}
+				return nil
+			},
+			wantIDs:      []string{"b1-1", "b1-2", "b1-3", "b2-1"},
+			wantStatuses: []string{StatusDone, StatusPending, StatusPending, StatusPending},
+		},
+		{
+			name:         "cancel one job",
+			edit:         func(a *App) error { a.CancelJob("b1-3"); return nil },
+			wantIDs:      []string{"b1-1", "b1-2", "b1-3", "b2-1"},
+			wantStatuses: []string{StatusDone, StatusError, StatusCancelled, StatusPending},
+		},
+		{
+			name:         "cancel everything",
+			edit:         func(a *App) error { a.CancelConversion(); return nil },
+			wantIDs:      []string{"b1-1", "b1-2", "b1-3", "b2-1"},
+			wantStatuses: []string{StatusDone, StatusError, StatusCancelled, StatusCancelled},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _ := testApp(t, false)
+			addJobs(a, "b1", StatusDone, StatusError, StatusPending)
+			addJobs(a, "b2", StatusPending)
+			if err := tt.edit(a); (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if got := jobIDs(a); !reflect.DeepEqual(got, tt.wantIDs) {
+				t.Errorf("queue = %v, want %v", got, tt.wantIDs)
+			}
+			if got := jobStatuses(a); !reflect.DeepEqual(got, tt.wantStatuses) {
+				t.Errorf("statuses = %v, want %v", got, tt.wantStatuses)
+			}
+		})
+	}
+}
+
+func TestQueueCancelSettlesBatch(t *testing.T) {
+	a, ev := testApp(t, false)
+	addJobs(a, "b1", StatusDone, StatusPending)
+	a.CancelJob("b1-2")
+	if got := ev.statuses()["b1-2"]; got != StatusCancelled {
+		t.Errorf("event status = %q, want cancelled", got)
+	}
+	if s := a.GetQueueState(); s.Running || len(s.Batches) != 0 {
+		t.Errorf("state after cancelling the last job = %+v", s)
+	}
+	if err := a.Remove("b1-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Remove("b1-2"); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.batches) != 0 {
+		t.Errorf("batch kept after its last job was removed")
+	}
+}
+
+func TestNextJob(t *testing.T) {
+	a, _ := testApp(t, false)
+	addJobs(a, "b1", StatusDone, StatusPending)
+	addJobs(a, "b2", StatusPending)
+	if err := a.Reorder("b2-1", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	_, j, b := a.nextJob()
+	if j.ID != "b2-1" || b.id != "b2" || j.Status != StatusConverting {
+		t.Fatalf("first job = %s (%s) of %s, want b2-1 converting", j.ID, j.Status, b.id)
+	}
+
+	// A paused queue dispatches nothing until resumed
+	a.PauseConversion()
+	if !a.GetQueueState().Paused {
+		t.Fatal("queue not paused")
+	}
+	got := make(chan *Job)
+	go func() {
+		_, j, _ := a.nextJob()
+		got <- j
+	}()
+	select {
+	case j := <-got:
+		t.Fatalf("dispatched %s while paused", j.ID)
+	case <-time.After(50 * time.Millisecond):
+	}
+	a.ResumeConversion()
+	select {
+	case j := <-got:
+		if j.ID != "b1-2" {
+			t.Errorf("next job = %s, want b1-2", j.ID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("not dispatched after resuming")
+	}
+
+	// Shutting down releases waiting workers
+	go func() {
+		_, j, _ := a.nextJob()
+		got <- j
+	}()
+	a.mu.Lock()
+	a.closing = true
+	a.wake.Broadcast()
+	a.mu.Unlock()
+	select {
+	case j := <-got:
+		if j != nil {
+			t.Errorf("dispatched %s while closing", j.ID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("worker not released")
+	}
+}
+
+func TestPauseIdleQueue(t *testing.T) {
+	a, ev := testApp(t, false)
+	a.PauseConversion()
+	if a.GetQueueState().Paused || len(ev.states) != 0 {
+		t.Error("idle queue paused")
+	}
+}
+
+func TestEnqueue(t *testing.T) {
+	a, ev := testApp(t, true)
+	if _, err := a.Enqueue(nil, "", ""); err == nil {
+		t.Error("empty batch accepted")
+	}
+
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "a.ncm"), filepath.Join(dir, "b.ncm"), filepath.Join(dir, "c.ncm")}
+	id, err := a.Enqueue(paths, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The files do not exist, so every job fails once a worker reads it
+	deadline := time.Now().Add(10 * time.Second)
+	for a.GetQueueState().Running {
+		if time.Now().After(deadline) {
+			t.Fatalf("batch still running: %v", jobStatuses(a))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	want := map[string]string{id + "-1": StatusError, id + "-2": StatusError, id + "-3": StatusError}
+	if got := ev.statuses(); !reflect.DeepEqual(got, want) {
+		t.Errorf("final events = %v, want %v", got, want)
+	}
+	for i, j := range a.GetQueue() {
+		if j.Path != paths[i] || j.Index != i+1 || j.BatchID != id || j.Result == nil {
+			t.Errorf("job %d = %+v", i, j)
+		}
+	}
+}
+
+func TestWaitPlanned(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "a.ncm"), filepath.Join(dir, "b.ncm")}
+	a := NewApp()
+	b := a.newBatch("", "", len(paths))
+	b.planned = []chan struct{}{make(chan struct{}), make(chan struct{})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := b.waitPlanned(ctx, 2); !errors.Is(err, context.Canceled) {
+		t.Errorf("waitPlanned before planning = %v, want context.Canceled", err)
+	}
+	// Files that cannot be read are still marked planned
+	b.planOutputs(paths)
+	for i := range paths {
+		if err := b.waitPlanned(context.Background(), i+1); err != nil {
+			t.Errorf("waitPlanned(%d) = %v", i+1, err)
+		}
+	}
+	// Restored batches are not planned again
+	if err := a.newBatch("", "", 1).waitPlanned(ctx, 1); err != nil {
+		t.Errorf("restored batch: %v", err)
+	}
+}
+
+func TestBatchesShareReservations(t *testing.T) {
+	a, _ := testApp(t, false)
+	addJobs(a, "b1", StatusPending)
+	addJobs(a, "b2", StatusPending)
+	out := filepath.Join(t.TempDir(), "Song.mp3")
+	reserve := func(id string) string {
+		b := a.batches[id[:2]]
+		return b.reservations.Reserve(out, id, b.collision)
+	}
+
+	if got := reserve("b1-1"); got != out {
+		t.Fatalf("first batch reserved %q", got)
+	}
+	if got := reserve("b2-1"); got == out {
+		t.Errorf("second batch reserved the first batch's path %q", got)
+	}
+	// Once its batch is over, the path is free for later batches
+	a.CancelJob("b1-1")
+	if _, ok := a.reservations.Lookup("b1-1"); ok {
+		t.Error("settled batch still holds its path")
+	}
+	addJobs(a, "b3", StatusPending)
+	if got := reserve("b3-1"); got != out {
+		t.Errorf("later batch reserved %q, want %q", got, out)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"PureNCM/internal/config"
+	"PureNCM/internal/ncm"
+)
+
+// RewriteSample is sample metadata for trying rewrite rules in the settings page.
+type RewriteSample struct {
+	Title   string   `json:"title"`
+	Artists []string `json:"artists"`
+	Album   string   `json:"album"`
+}
+
+// TestRewriteRule applies a single rule to sample and returns the result,
+// or the validation error for the rule.
+func (a *App) TestRewriteRule(rule config.RewriteRule, sample RewriteSample) (RewriteSample, error) {
+	rw, err := ncm.NewRewriter(rewriteRules([]config.RewriteRule{rule}))
+	if err != nil {
+		return sample, err
+	}
+	meta := &ncm.Meta{MusicName: sample.Title, Album: sample.Album}
+	meta.SetArtistNames(sample.Artists)
+	rw.Apply(meta)
+	return RewriteSample{Title: meta.MusicName, Artists: meta.ArtistNames(), Album: meta.Album}, nil
+}
+
+// rewriteRules maps the persisted rules onto ncm.RewriteRule.
+func rewriteRules(rules []config.RewriteRule) []ncm.RewriteRule {
+	out := make([]ncm.RewriteRule, len(rules))
+	for i, r := range rules {
+		out[i] = ncm.RewriteRule{
+			Field:   ncm.RewriteField(r.Field),
+			Action:  ncm.RewriteAction(r.Action),
+			Pattern: r.Pattern,
+			Replace: r.Replace,
+		}
+	}
+	return out
+}
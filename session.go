@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"time"
+
+	"PureNCM/internal/config"
+	"PureNCM/internal/ncm"
+)
+
+// queueFileName is the saved job queue under the config dir. It exists only
+// while some job is unfinished, so finding it at startup means the last
+// session was interrupted.
+const queueFileName = "queue.json"
+
+// savedQueue is the on-disk form of the job queue.
+type savedQueue struct {
+	Batches []savedBatch `json:"batches"`
+	Jobs    []*Job       `json:"jobs"` // in queue order
+	// Outputs holds the output path reserved for each job, by job ID, so a
+	// resumed batch gives every file the name it had before.
+	Outputs map[string]ncm.Reservation `json:"outputs,omitempty"`
+}
+
+// savedBatch holds what is needed to rebuild a batch: its settings other
+// than these are taken from the config when it is resumed.
+type savedBatch struct {
+	ID        string    `json:"id"`
+	OutputDir string    `json:"outputDir"`
+	Pattern   string    `json:"pattern"`
+	Total     int       `json:"total"`
+	Created   time.Time `json:"created"`
+	Collision string    `json:"collision,omitempty"`
+}
+
+// InterruptedQueue describes the queue left unfinished by the last session.
+type InterruptedQueue struct {
+	Jobs      int `json:"jobs"`      // jobs in the saved queue
+	Remaining int `json:"remaining"` // jobs not yet converted
+	CleanedUp int `json:"cleanedUp"` // partial outputs removed at startup
+}
+
+// outputDirs returns the directories the saved batches write to.
+func (q *savedQueue) outputDirs() []string {
+	var dirs []string
+	for _, b := range q.Batches {
+		if b.OutputDir != "" {
+			dirs = append(dirs, b.OutputDir)
+			continue
+		}
+		for _, j := range q.Jobs {
+			if j.BatchID == b.ID {
+				dirs = append(dirs, filepath.Dir(j.Path)) // next to each source
+			}
+		}
+	}
+	return dirs
+}
+
+// GetInterruptedQueue returns the queue left unfinished by the last
+// session, or nil when there is none or it has been resumed or discarded.
+func (a *App) GetInterruptedQueue() *InterruptedQueue {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.interrupted == nil {
+		return nil
+	}
+	q := &InterruptedQueue{Jobs: len(a.interrupted.Jobs), CleanedUp: a.cleanedUp}
+	for _, j := range a.interrupted.Jobs {
+		if !j.finished() {
+			q.Remaining++
+		}
+	}
+	return q
+}
+
+// ResumeQueue puts the interrupted queue back ahead of any new jobs and
+// starts it. Jobs that finished before the interruption keep their
+// results; unfinished ones whose output was written after their batch
+// started are marked skipped rather than converted again.
+func (a *App) ResumeQueue() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	saved := a.interrupted
+	if saved == nil {
+		return errors.New("没有可恢复的队列")
+	}
+	batches := make(map[string]*batch, len(saved.Batches))
+	for _, sb := range saved.Batches {
+		batches[sb.ID] = a.restoreBatch(sb, saved.Jobs, saved.Outputs)
+	}
+	var jobs []*Job
+	for _, j := range saved.Jobs {
+		b := batches[j.BatchID]
+		if b == nil {
+			continue // batch missing from a hand-edited file
+		}
+		a.batches[b.id] = b
+		if !j.finished() {
+			b.active = true
+		}
+		jobs = append(jobs, j)
+	}
+	a.jobs = append(jobs, a.jobs...)
+	for _, b := range batches {
+		if !b.active {
+			a.release(b.id) // nothing left to write
+		}
+	}
+	a.interrupted = nil // only now, so saveQueue never loses the jobs
+	a.startWorkers()
+	a.wake.Broadcast()
+	a.emitQueueState()
+	a.saveQueue()
+	return nil
+}
+
+// DiscardQueue drops the interrupted queue.
+func (a *App) DiscardQueue() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.interrupted = nil
+	a.saveQueue()
+}
+
+// restoreBatch rebuilds saved batch sb and prepares its jobs among jobs to
+// run again. Every job gets back the output path it had reserved, finished
+// ones included, so a resumed job can neither take nor overwrite another's.
+func (a *App) restoreBatch(sb savedBatch, jobs []*Job, outputs map[string]ncm.Reservation) *batch {
+	b := a.newBatch(sb.OutputDir, sb.Pattern, sb.Total)
+	b.id, b.created = sb.ID, sb.Created
+	if sb.Collision != "" {
+		b.collision = ncm.CollisionPolicy(sb.Collision)
+	}
+	for _, j := range jobs {
+		if j.BatchID != b.id {
+			continue
+		}
+		res, reserved := outputs[j.ID]
+		if reserved {
+			b.reservations.Restore(j.ID, res, b.collision)
+		}
+		if j.finished() {
+			continue
+		}
+		// A job still converting when the session ended starts over
+		j.Status, j.Progress, j.Result = StatusPending, 0, nil
+		if !reserved {
+			continue // not planned yet; the writer reserves its path
+		}
+		if fi, err := os.Stat(res.Path); err == nil && fi.ModTime().After(b.created) {
+			// Written before the save that would have marked it finished
+			j.Status, j.Progress = StatusSkipped, 1
+			j.Result = &ConvertProgress{JobID: j.ID, BatchID: j.BatchID, Path: j.Path, Status: StatusSkipped, Size: j.Size, Progress: 1, OutputPath: res.Path}
+		}
+	}
+	return b
+}
+
+// loadQueue reads the queue saved by the last session. It is kept for
+// GetInterruptedQueue when some of its jobs are unfinished.
+func (a *App) loadQueue() {
+	dir, err := config.Dir()
+	if err != nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.queuePath = filepath.Join(dir, queueFileName)
+	data, err := os.ReadFile(a.queuePath)
+	if err != nil {
+		return
+	}
+	var saved savedQueue
+	if err := json.Unmarshal(data, &saved); err != nil {
+		_ = os.Remove(a.queuePath) // unreadable; nothing to offer
+		return
+	}
+	for _, j := range saved.Jobs {
+		if !j.finished() {
+			a.interrupted = &saved
+			return
+		}
+	}
+	_ = os.Remove(a.queuePath)
+}
+
+// saveQueue writes the queue, with any interrupted queue not yet resumed,
+// or removes the file when no job is left to convert. It runs when jobs
+// are added, removed, reordered or finish, not on progress. Failures are
+// non-fatal. The caller holds a.mu.
+func (a *App) saveQueue() {
+	if a.queuePath == "" {
+		return
+	}
+	saved := savedQueue{Outputs: map[string]ncm.Reservation{}}
+	if a.interrupted != nil {
+		saved.Batches = append(saved.Batches, a.interrupted.Batches...)
+		saved.Jobs = append(saved.Jobs, a.interrupted.Jobs...)
+		maps.Copy(saved.Outputs, a.interrupted.Outputs)
+	}
+	for _, b := range a.batches {
+		saved.Batches = append(saved.Batches, savedBatch{
+			ID:        b.id,
+			OutputDir: b.outputDir,
+			Pattern:   b.pattern,
+			Total:     b.total,
+			Created:   b.created,
+			Collision: string(b.collision),
+		})
+	}
+	for _, j := range a.jobs {
+		if b := a.batches[j.BatchID]; b != nil {
+			if res, ok := b.reservations.Lookup(j.ID); ok {
+				saved.Outputs[j.ID] = res
+			}
+		}
+	}
+	saved.Jobs = append(saved.Jobs, a.jobs...)
+
+	unfinished := false
+	for _, j := range saved.Jobs {
+		if !j.finished() {
+			unfinished = true
+			break
+		}
+	}
+	if !unfinished {
+		_ = os.Remove(a.queuePath)
+		return
+	}
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(a.queuePath), 0755); err != nil {
+		return
+	}
+	_ = ncm.WriteFileAtomic(a.queuePath, data)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"PureNCM/internal/ncm"
+)
+
+func TestRestoreBatch(t *testing.T) {
+	dir := t.TempDir()
+	created := time.Now().Add(-time.Hour)
+	out := func(name string) string { return filepath.Join(dir, name) }
+	for _, name := range []string{"Song.mp3", "Song (3).mp3"} {
+		if err := os.WriteFile(out(name), []byte("audio"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := out("Old.mp3") // left by an earlier run, before the batch started
+	if err := os.WriteFile(old, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(old, created.Add(-time.Hour), created.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs := []*Job{
+		{ID: "b1-1", BatchID: "b1", Path: "a.ncm", Index: 1, Status: StatusDone},
+		{ID: "b1-2", BatchID: "b1", Path: "b.ncm", Index: 2, Status: StatusConverting, Progress: 0.5},
+		{ID: "b1-3", BatchID: "b1", Path: "c.ncm", Index: 3, Status: StatusPending},
+		{ID: "b1-4", BatchID: "b1", Path: "d.ncm", Index: 4, Status: StatusPending},
+		{ID: "b1-5", BatchID: "b1", Path: "e.ncm", Index: 5, Status: StatusPending},
+		{ID: "b2-1", BatchID: "b2", Path: "a.ncm", Index: 1, Status: StatusPending},
+	}
+	outputs := map[string]ncm.Reservation{
+		"b1-1": {Requested: out("Song.mp3"), Path: out("Song.mp3")},
+		"b1-2": {Requested: out("Song.mp3"), Path: out("Song (2).mp3")},
+		"b1-3": {Requested: out("Song.mp3"), Path: out("Song (3).mp3")},
+		"b1-4": {Requested: old, Path: old},
+		"b2-1": {Requested: out("Other.mp3"), Path: out("Other.mp3")},
+	}
+	sb := savedBatch{ID: "b1", OutputDir: dir, Pattern: "{title}", Total: 5, Created: created, Collision: string(ncm.CollisionOverwrite)}
+	b := NewApp().restoreBatch(sb, jobs, outputs)
+
+	want := []struct {
+		status string
+		output string // OutputPath of the result, for skipped jobs
+	}{
+		{StatusDone, ""},
+		{StatusPending, ""}, // its sibling's Song.mp3 is not its output
+		{StatusSkipped, out("Song (3).mp3")},
+		{StatusPending, ""}, // output older than the batch
+		{StatusPending, ""}, // never planned
+		{StatusPending, ""}, // another batch: untouched
+	}
+	for i, j := range jobs {
+		if j.Status != want[i].status {
+			t.Errorf("job %s: status %q, want %q", j.ID, j.Status, want[i].status)
+		}
+		if want[i].output != "" && (j.Result == nil || j.Result.OutputPath != want[i].output) {
+			t.Errorf("job %s: result %+v, want output %q", j.ID, j.Result, want[i].output)
+		}
+	}
+	if jobs[1].Progress != 0 {
+		t.Errorf("interrupted job keeps progress %v", jobs[1].Progress)
+	}
+
+	// The resumed job writes where it had planned, and a new file with the
+	// same name cannot take a finished job's output
+	if got := b.reservations.Reserve(out("Song.mp3"), "b1-2", b.collision); got != out("Song (2).mp3") {
+		t.Errorf("resumed job reserved %q", got)
+	}
+	if got := b.reservations.Reserve(out("Song.mp3"), "b3-1", b.collision); got != out("Song (4).mp3") {
+		t.Errorf("new job reserved %q", got)
+	}
+	if _, ok := b.reservations.Lookup("b1-1"); !ok {
+		t.Error("finished job's output is not reserved")
+	}
+}
+
+func TestSaveQueue(t *testing.T) {
+	dir := t.TempDir()
+	a := NewApp()
+	a.queuePath = filepath.Join(dir, "config", queueFileName)
+
+	b := a.newBatch(dir, "{title}", 2)
+	b.id = "b1"
+	a.batches[b.id] = b
+	a.jobs = []*Job{
+		{ID: "b1-1", BatchID: "b1", Path: "a.ncm", Index: 1, Status: StatusDone},
+		{ID: "b1-2", BatchID: "b1", Path: "b.ncm", Index: 2, Status: StatusPending},
+	}
+	b.reservations.Reserve(filepath.Join(dir, "Song.mp3"), "b1-1", b.collision)
+	b.reservations.Reserve(filepath.Join(dir, "Song.mp3"), "b1-2", b.collision)
+	a.interrupted = &savedQueue{
+		Batches: []savedBatch{{ID: "b0"}},
+		Jobs:    []*Job{{ID: "b0-1", BatchID: "b0", Path: "z.ncm", Status: StatusPending}},
+		Outputs: map[string]ncm.Reservation{"b0-1": {Path: "Z.mp3"}},
+	}
+
+	a.saveQueue()
+	data, err := os.ReadFile(a.queuePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved savedQueue
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.Batches) != 2 || len(saved.Jobs) != 3 {
+		t.Fatalf("saved %d batches and %d jobs, want 2 and 3", len(saved.Batches), len(saved.Jobs))
+	}
+	for id, want := range map[string]string{
+		"b0-1": "Z.mp3",
+		"b1-1": filepath.Join(dir, "Song.mp3"),
+		"b1-2": filepath.Join(dir, "Song (2).mp3"),
+	} {
+		if got := saved.Outputs[id].Path; got != want {
+			t.Errorf("output of %s = %q, want %q", id, got, want)
+		}
+	}
+
+	// Nothing left to convert: the file goes
+	a.interrupted = nil
+	a.jobs[1].Status = StatusDone
+	a.saveQueue()
+	if _, err := os.Stat(a.queuePath); !os.IsNotExist(err) {
+		t.Errorf("queue file left behind: %v", err)
+	}
+}